@@ -0,0 +1,169 @@
+package wf
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Redacted replaces a secret value in logs.
+const Redacted = "[REDACTED]"
+
+// DefaultRedact is what [AccessLog] redacts if its Redact is nil.
+var DefaultRedact = []string{"Authorization", "Cookie", "Set-Cookie", "Token", "X-API-Key", "password", "secret", "token"}
+
+// AccessLog configures the record [Web] logs once a request is served, see [Web.SetAccessLog].
+// A record has method, route pattern, path, status, bytes written, latency, request ID and the principal subject.
+type AccessLog struct {
+	// Level of records, whose zero value is [slog.LevelInfo]. Records of 5XX are always [slog.LevelError].
+	Level slog.Level
+	// Headers are request headers to record, such as User-Agent.
+	Headers []string
+	// Redact names headers and JSON body fields, case-insensitive, whose values are recorded as [Redacted].
+	// Nil as [DefaultRedact], empty as nothing redacted.
+	Redact []string
+	// MaxBody is how many bytes of a JSON request body to record, zero as none.
+	// A body longer than it is not recorded, as a truncated JSON could not be redacted.
+	MaxBody int
+	// Sampling is the ratio in [0, 1] of requests recorded, keyed by [Route.Pattern] as a string,
+	// for high-volume routes. A request responded with 4XX or 5XX is always recorded.
+	Sampling map[string]float64
+}
+
+func (al *AccessLog) redacts(name string) bool {
+	redact := al.Redact
+	if redact == nil {
+		redact = DefaultRedact
+	}
+	return slices.ContainsFunc(redact, func(s string) bool {
+		return strings.EqualFold(s, name)
+	})
+}
+
+func (al *AccessLog) sampled(route Route, status int) bool {
+	ratio, ok := al.Sampling[route.Pattern.String()]
+	return !ok || status >= http.StatusBadRequest || rand.Float64() < ratio
+}
+
+// SetAccessLog makes every served request recorded as al, nil as none.
+// Better to use before the start of serving, as it's not concurrency safe.
+func (w *Web) SetAccessLog(al *AccessLog) {
+	w.accessLog = al
+}
+
+// SetLogger sets up the logger of the framework for requests, rather than [slog.Default].
+// Better to use before the start of serving, as it's not concurrency safe.
+func (w *Web) SetLogger(logger *slog.Logger) {
+	w.logger = logger
+}
+
+func (w *Web) log() *slog.Logger {
+	if w.logger != nil {
+		return w.logger
+	}
+	return slog.Default()
+}
+
+// bodyRecorder keeps the head of a request body as it's read.
+type bodyRecorder struct {
+	io.ReadCloser
+	buf   bytes.Buffer
+	limit int
+	over  bool
+}
+
+func (br *bodyRecorder) Read(p []byte) (int, error) {
+	n, err := br.ReadCloser.Read(p)
+	if room := br.limit - br.buf.Len(); n > room {
+		br.over = true
+		br.buf.Write(p[:max(room, 0)])
+	} else {
+		br.buf.Write(p[:n])
+	}
+	return n, err
+}
+
+// recordBody makes the body of request recorded if it's JSON, nil as not recorded.
+func (al *AccessLog) recordBody(request *http.Request) *bodyRecorder {
+	if al.MaxBody <= 0 || request.Body == nil || request.Body == http.NoBody {
+		return nil
+	}
+	if mt, _, _ := mime.ParseMediaType(request.Header.Get("Content-Type")); mt != "application/json" {
+		return nil
+	}
+	br := &bodyRecorder{ReadCloser: request.Body, limit: al.MaxBody}
+	request.Body = br
+	return br
+}
+
+// record logs the access of request, which is responded through writer since start.
+func (al *AccessLog) record(logger *slog.Logger, request *http.Request, route Route, writer *responseWriter, start time.Time, body *bodyRecorder) {
+	status := cmp.Or(writer.status, http.StatusOK)
+	if !al.sampled(route, status) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("method", request.Method),
+		slog.String("route", route.Pattern.String()),
+		slog.String("path", request.URL.Path),
+		slog.Int("status", status),
+		slog.Int64("bytes", writer.written),
+		slog.Duration("latency", time.Since(start)),
+	}
+	if p, ok := DetachPrincipal(request.Context()); ok {
+		attrs = append(attrs, slog.String("principal", p.Subject))
+	}
+	var headers []any
+	for _, name := range al.Headers {
+		value := request.Header.Get(name)
+		if value == "" {
+			continue
+		}
+		if al.redacts(name) {
+			value = Redacted
+		}
+		headers = append(headers, slog.String(name, value))
+	}
+	if len(headers) > 0 {
+		attrs = append(attrs, slog.Group("headers", headers...))
+	}
+	if body != nil && !body.over && body.buf.Len() > 0 {
+		var v any
+		if err := json.Unmarshal(body.buf.Bytes(), &v); err == nil {
+			redacted, _ := json.Marshal(al.redactJSON(v))
+			attrs = append(attrs, slog.String("body", string(redacted)))
+		}
+	}
+	level := al.Level
+	if status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	logger.LogAttrs(context.Background(), level, "access", attrs...)
+}
+
+func (al *AccessLog) redactJSON(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, field := range v {
+			if al.redacts(k) {
+				v[k] = Redacted
+			} else {
+				v[k] = al.redactJSON(field)
+			}
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = al.redactJSON(e)
+		}
+	}
+	return v
+}
@@ -0,0 +1,81 @@
+package wf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	type login struct {
+		User     string `json:"user"`
+		Password string `json:"password"`
+	}
+	web := NewWeb(false,
+		NewJSONHandler(Exact(http.MethodPost, "/login"), reflect.TypeOf(login{}),
+			func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+				return "welcome", nil
+			}),
+		NewEchoHandler("/health", 0, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+			return []byte("ok"), nil
+		}),
+	)
+	var buf bytes.Buffer
+	web.SetLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+	web.SetAccessLog(&AccessLog{
+		Headers:  []string{"User-Agent", "Token"},
+		MaxBody:  1024,
+		Sampling: map[string]float64{"/health": 0},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"user":"alice","password":"p@ss"}`))
+	req.Header.Set("Content-Type", JSONContentType)
+	req.Header.Set("User-Agent", "test")
+	req.Header.Set("Token", "secret")
+	req.Header.Set(RequestIDHeader, "r1")
+	web.ServeHTTP(httptest.NewRecorder(), req)
+	web.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+	web.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record["msg"] == "access" {
+			records = append(records, record)
+		}
+	}
+	if len(records) != 2 {
+		t.Fatalf("want login and missing recorded, but health sampled out, got %v", records)
+	}
+
+	login0 := records[0]
+	for k, v := range map[string]any{
+		"method":    "POST",
+		"route":     "/login",
+		"status":    float64(http.StatusOK),
+		"requestID": "r1",
+		"body":      `{"password":"[REDACTED]","user":"alice"}`,
+	} {
+		if login0[k] != v {
+			t.Errorf("want %s %v, got %v", k, v, login0[k])
+		}
+	}
+	if headers, _ := login0["headers"].(map[string]any); headers["Token"] != Redacted || headers["User-Agent"] != "test" {
+		t.Errorf("unexpected headers %v", login0["headers"])
+	}
+	if records[1]["status"] != float64(http.StatusNotAcceptable) {
+		t.Errorf("want unmatched recorded, got %v", records[1])
+	}
+	if strings.Contains(buf.String(), "secret") || strings.Contains(buf.String(), "p@ss") {
+		t.Errorf("secret leaked in %s", buf.String())
+	}
+}
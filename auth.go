@@ -0,0 +1,260 @@
+package wf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Principal is who sends a request, resolved by an [Authenticator].
+type Principal struct {
+	Subject string
+	Roles   []string
+	Scopes  []string
+	// Credential is what the Principal is resolved from, such as the claims of a JWT.
+	Credential any
+}
+
+// ErrNoCredentials is returned by an [Authenticator] that finds no credentials of its kind in a request,
+// which rejects the request, unless it's [AnyOf] that tries the next one, or [Optional] that lets it go.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authenticator resolves the [Principal] of a request, before it's parsed.
+// [Web] rejects the request with 401 and WWW-Authenticate on any error.
+type Authenticator interface {
+	// Authenticate returns a nil Principal without error for an anonymous request.
+	Authenticate(req *http.Request) (*Principal, error)
+	// Challenge is the value of WWW-Authenticate on rejection, such as `Bearer realm="api"`, empty as none.
+	Challenge() string
+}
+
+// HaveAuthenticator is optional for a [Handler] to override the one of [Web], where nil means no authentication.
+type HaveAuthenticator interface {
+	Authenticator() Authenticator
+}
+
+// VerifyFunc resolves credential, such as a token, into a [Principal], or returns the reason why it's invalid.
+type VerifyFunc func(ctx context.Context, credential string) (*Principal, error)
+
+var principalValue = NewContextValue[*Principal]("principal")
+
+func AttachPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return principalValue.Attach(ctx, principal)
+}
+
+// DetachPrincipal returns the [Principal] resolved by [Authenticator], false for an anonymous request.
+func DetachPrincipal(ctx context.Context) (*Principal, bool) {
+	p, ok := principalValue.Detach(ctx)
+	return p, ok && p != nil
+}
+
+// SetAuthenticator sets up the [Authenticator] for every [Handler], unless it's [HaveAuthenticator].
+// Better to use before the start of serving, as it's not concurrency safe.
+func (w *Web) SetAuthenticator(a Authenticator) {
+	w.authenticator = a
+}
+
+type authenticatorHandler struct {
+	Handler
+	authenticator Authenticator
+}
+
+// WithAuthenticator makes h authenticated by a rather than the one of [Web], nil as no authentication.
+func WithAuthenticator(h Handler, a Authenticator) Handler {
+	return &authenticatorHandler{Handler: h, authenticator: a}
+}
+
+func (ah *authenticatorHandler) Authenticator() Authenticator {
+	return ah.authenticator
+}
+
+func (ah *authenticatorHandler) Unwrap() Handler {
+	return ah.Handler
+}
+
+func (ah *authenticatorHandler) Describe() Route {
+	return describeHandler(ah.Handler)
+}
+
+// authenticate returns request with [Principal] attached, or false once it has been rejected.
+func (w *Web) authenticate(h Handler, writer http.ResponseWriter, request *http.Request) (*http.Request, bool) {
+	a := w.authenticator
+	if ha, ok := handlerAs[HaveAuthenticator](h); ok {
+		a = ha.Authenticator()
+	}
+	if a == nil {
+		return request, true
+	}
+	p, err := a.Authenticate(request)
+	if err != nil {
+		// An error of a verifier could hold the credential, which is kept out of responses and logs.
+		detail := "invalid credentials"
+		if errors.Is(err, ErrNoCredentials) {
+			detail = ErrNoCredentials.Error()
+		}
+		Logger(request.Context()).Warn("unauthenticated request", "cause", detail, "errType", fmt.Sprintf("%T", err),
+			"method", request.Method, "path", request.URL.Path)
+		if challenge := a.Challenge(); challenge != "" {
+			writer.Header().Set("WWW-Authenticate", challenge)
+		}
+		writeProblem(writer, request, http.StatusUnauthorized, detail)
+		return nil, false
+	}
+	if p == nil {
+		return request, true
+	}
+	return request.WithContext(AttachPrincipal(request.Context(), p)), true
+}
+
+// credentialAuthenticator extracts a single credential from a request and verifies it.
+type credentialAuthenticator struct {
+	extract   func(req *http.Request) (string, bool)
+	verify    VerifyFunc
+	challenge string
+}
+
+func (ca *credentialAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+	credential, found := ca.extract(req)
+	if !found {
+		return nil, ErrNoCredentials
+	}
+	return verified(ca.verify(req.Context(), credential))
+}
+
+// verified makes sure a Principal is resolved without error.
+func verified(p *Principal, err error) (*Principal, error) {
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, errors.New("invalid credentials")
+	}
+	return p, nil
+}
+
+func (ca *credentialAuthenticator) Challenge() string {
+	return ca.challenge
+}
+
+// BearerAuth authenticates with `Authorization: Bearer <token>`.
+func BearerAuth(realm string, verify VerifyFunc) Authenticator {
+	return &credentialAuthenticator{
+		extract: func(req *http.Request) (string, bool) {
+			scheme, token, found := strings.Cut(req.Header.Get("Authorization"), " ")
+			if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+				return "", false
+			}
+			return strings.TrimSpace(token), true
+		},
+		verify:    verify,
+		challenge: fmt.Sprintf("Bearer realm=%q", realm),
+	}
+}
+
+// BasicAuth authenticates with HTTP Basic, see [http.Request.BasicAuth].
+func BasicAuth(realm string, verify func(ctx context.Context, username string, password string) (*Principal, error)) Authenticator {
+	return &basicAuthenticator{realm: realm, verify: verify}
+}
+
+type basicAuthenticator struct {
+	realm  string
+	verify func(ctx context.Context, username string, password string) (*Principal, error)
+}
+
+func (ba *basicAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+	username, password, ok := req.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	return verified(ba.verify(req.Context(), username, password))
+}
+
+func (ba *basicAuthenticator) Challenge() string {
+	return fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", ba.realm)
+}
+
+// APIKeyAuth authenticates with an API key in header, or in query parameter if header is empty or absent.
+func APIKeyAuth(header string, query string, verify VerifyFunc) Authenticator {
+	return &credentialAuthenticator{
+		extract: func(req *http.Request) (string, bool) {
+			if header != "" {
+				if key := req.Header.Get(header); key != "" {
+					return key, true
+				}
+			}
+			if query != "" {
+				if key := req.URL.Query().Get(query); key != "" {
+					return key, true
+				}
+			}
+			return "", false
+		},
+		verify: verify,
+	}
+}
+
+// CookieAuth authenticates with the value of cookie name, such as a session ID.
+func CookieAuth(name string, verify VerifyFunc) Authenticator {
+	return &credentialAuthenticator{
+		extract: func(req *http.Request) (string, bool) {
+			cookie, err := req.Cookie(name)
+			if err != nil || cookie.Value == "" {
+				return "", false
+			}
+			return cookie.Value, true
+		},
+		verify: verify,
+	}
+}
+
+// TokenAuth authenticates with the Token header, which is also attached to ctx for [DetachToken].
+func TokenAuth(verify VerifyFunc) Authenticator {
+	return APIKeyAuth("Token", "", verify)
+}
+
+type anyOfAuthenticator []Authenticator
+
+// AnyOf authenticates with the first one in authenticators that finds its kind of credentials.
+func AnyOf(authenticators ...Authenticator) Authenticator {
+	return anyOfAuthenticator(authenticators)
+}
+
+func (aa anyOfAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+	for _, a := range aa {
+		p, err := a.Authenticate(req)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return p, err
+	}
+	return nil, ErrNoCredentials
+}
+
+func (aa anyOfAuthenticator) Challenge() string {
+	var challenges []string
+	for _, a := range aa {
+		if c := a.Challenge(); c != "" {
+			challenges = append(challenges, c)
+		}
+	}
+	return strings.Join(challenges, ", ")
+}
+
+type optionalAuthenticator struct {
+	Authenticator
+}
+
+// Optional lets a request without credentials go as anonymous, but still rejects invalid credentials.
+func Optional(a Authenticator) Authenticator {
+	return optionalAuthenticator{Authenticator: a}
+}
+
+func (oa optionalAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+	p, err := oa.Authenticator.Authenticate(req)
+	if errors.Is(err, ErrNoCredentials) {
+		return nil, nil
+	}
+	return p, err
+}
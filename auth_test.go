@@ -0,0 +1,100 @@
+package wf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuthenticate(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	verify := func(_ context.Context, credential string) (*Principal, error) {
+		if credential != "good" {
+			return nil, errors.New("bad credential")
+		}
+		return &Principal{Subject: "alice"}, nil
+	}
+	whoami := func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		if p, ok := DetachPrincipal(ctx); ok {
+			return []byte(p.Subject), nil
+		}
+		return []byte("anonymous"), nil
+	}
+	web := NewWeb(false,
+		NewEchoHandler("/private", 0, whoami),
+		WithAuthenticator(NewEchoHandler("/public", 0, whoami), nil),
+		WithAuthenticator(NewEchoHandler("/optional", 0, whoami), Optional(CookieAuth("session", verify))),
+	)
+	web.SetAuthenticator(AnyOf(
+		BearerAuth("api", verify),
+		BasicAuth("api", func(ctx context.Context, username string, password string) (*Principal, error) {
+			return verify(ctx, password)
+		}),
+		APIKeyAuth("X-API-Key", "api_key", verify),
+	))
+
+	tests := []struct {
+		name      string
+		target    string
+		header    [2]string
+		status    int
+		body      string
+		challenge string
+	}{
+		{"bearer", "/private", [2]string{"Authorization", "Bearer good"}, http.StatusOK, "alice", ""},
+		{"bad bearer", "/private", [2]string{"Authorization", "Bearer bad"}, http.StatusUnauthorized, `{"title":"Unauthorized","status":401,"detail":"invalid credentials","requestId":"r1"}`, `Bearer realm="api", Basic realm="api", charset="UTF-8"`},
+		{"basic", "/private", [2]string{"Authorization", "Basic Ym9iOmdvb2Q="}, http.StatusOK, "alice", ""},
+		{"api key header", "/private", [2]string{"X-API-Key", "good"}, http.StatusOK, "alice", ""},
+		{"api key query", "/private?api_key=good", [2]string{}, http.StatusOK, "alice", ""},
+		{"none", "/private", [2]string{}, http.StatusUnauthorized, `{"title":"Unauthorized","status":401,"detail":"no credentials","requestId":"r1"}`, `Bearer realm="api", Basic realm="api", charset="UTF-8"`},
+		{"public", "/public", [2]string{}, http.StatusOK, "anonymous", ""},
+		{"optional none", "/optional", [2]string{}, http.StatusOK, "anonymous", ""},
+		{"optional cookie", "/optional", [2]string{"Cookie", "session=good"}, http.StatusOK, "alice", ""},
+		{"optional bad cookie", "/optional", [2]string{"Cookie", "session=bad"}, http.StatusUnauthorized, `{"title":"Unauthorized","status":401,"detail":"invalid credentials","requestId":"r1"}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Header.Set(RequestIDHeader, "r1")
+			if tt.header[0] != "" {
+				req.Header.Set(tt.header[0], tt.header[1])
+			}
+			recorder := httptest.NewRecorder()
+			web.ServeHTTP(recorder, req)
+			if recorder.Code != tt.status || recorder.Body.String() != tt.body {
+				t.Errorf("want %d %q, got %d %q", tt.status, tt.body, recorder.Code, recorder.Body.String())
+			}
+			if got := recorder.Header().Get("WWW-Authenticate"); got != tt.challenge {
+				t.Errorf("want challenge %q, got %q", tt.challenge, got)
+			}
+		})
+	}
+}
+
+func TestAuthenticateKeepsCredentialsSecret(t *testing.T) {
+	web := NewWeb(false, NewEchoHandler("/private", 0, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		return []byte("ok"), nil
+	}))
+	var logs bytes.Buffer
+	web.SetLogger(slog.New(slog.NewTextHandler(&logs, nil)))
+	web.SetAuthenticator(TokenAuth(func(_ context.Context, credential string) (*Principal, error) {
+		return nil, fmt.Errorf("invalid token %s", credential)
+	}))
+	request := httptest.NewRequest(http.MethodGet, "/private", nil)
+	request.Header.Set("Token", "s3cr3t")
+	recorder := httptest.NewRecorder()
+	web.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusUnauthorized || strings.Contains(recorder.Body.String(), "s3cr3t") {
+		t.Errorf("want 401 without the credential, got %d %s", recorder.Code, recorder.Body)
+	}
+	if strings.Contains(logs.String(), "s3cr3t") {
+		t.Errorf("want the credential kept out of logs, got %s", logs.String())
+	}
+}
@@ -0,0 +1,133 @@
+package wf
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Policy decides whether principal may act on req, returning the reason why not.
+type Policy func(ctx context.Context, principal *Principal, req *http.Request) error
+
+// Requirement declares who may act on a [Handler], enforced by [Web] after authentication and before parsing.
+// A request without a [Principal] is rejected with 401, and one whose Principal doesn't fulfil with 403.
+type Requirement struct {
+	Roles  []string // any one of them, empty as no requirement
+	Scopes []string // all of them
+	// PolicyName names Policy in the route table, as a function itself is opaque.
+	PolicyName string
+	Policy     Policy
+}
+
+func (r Requirement) String() string {
+	var parts []string
+	if len(r.Roles) > 0 {
+		parts = append(parts, "role:"+strings.Join(r.Roles, "|"))
+	}
+	if len(r.Scopes) > 0 {
+		parts = append(parts, "scope:"+strings.Join(r.Scopes, "+"))
+	}
+	if r.Policy != nil {
+		parts = append(parts, "policy:"+r.PolicyName)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (r Requirement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Roles  []string `json:"roles,omitempty"`
+		Scopes []string `json:"scopes,omitempty"`
+		Policy string   `json:"policy,omitempty"`
+	}{r.Roles, r.Scopes, r.PolicyName})
+}
+
+// check returns why principal fails r, nil if it fulfils.
+func (r Requirement) check(ctx context.Context, principal *Principal, req *http.Request) error {
+	if len(r.Roles) > 0 && !slices.ContainsFunc(r.Roles, func(role string) bool {
+		return slices.Contains(principal.Roles, role)
+	}) {
+		return fmt.Errorf("requires any role of %v", r.Roles)
+	}
+	for _, scope := range r.Scopes {
+		if !slices.Contains(principal.Scopes, scope) {
+			return fmt.Errorf("requires scope %s", scope)
+		}
+	}
+	if r.Policy != nil {
+		if err := r.Policy(ctx, principal, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HaveRequirement is optional for a [Handler] to restrict who may act on it.
+// Every requirement along the wrapping chain must be fulfilled.
+type HaveRequirement interface {
+	Requirement() Requirement
+}
+
+type requirementHandler struct {
+	Handler
+	requirement Requirement
+}
+
+// Require makes h only for a [Principal] that fulfils r, in addition to any requirement h has already.
+func Require(h Handler, r Requirement) Handler {
+	return &requirementHandler{Handler: h, requirement: r}
+}
+
+// RequireRoles makes h only for a [Principal] with any one of roles.
+func RequireRoles(h Handler, roles ...string) Handler {
+	return Require(h, Requirement{Roles: roles})
+}
+
+// RequireScopes makes h only for a [Principal] with all of scopes.
+func RequireScopes(h Handler, scopes ...string) Handler {
+	return Require(h, Requirement{Scopes: scopes})
+}
+
+// RequirePolicy makes h only for a [Principal] that policy approves, which is shown as name in the route table.
+func RequirePolicy(h Handler, name string, policy Policy) Handler {
+	return Require(h, Requirement{PolicyName: name, Policy: policy})
+}
+
+func (rh *requirementHandler) Requirement() Requirement {
+	return rh.requirement
+}
+
+func (rh *requirementHandler) Unwrap() Handler {
+	return rh.Handler
+}
+
+func (rh *requirementHandler) Describe() Route {
+	r := describeHandler(rh.Handler)
+	r.Requirements = append([]Requirement{rh.requirement}, r.Requirements...)
+	return r
+}
+
+// authorize tells whether the [Principal] of request fulfils every requirement of h,
+// or rejects it with a [Problem].
+func (w *Web) authorize(h Handler, writer http.ResponseWriter, request *http.Request) bool {
+	requirements := collect[HaveRequirement](h)
+	if len(requirements) == 0 {
+		return true
+	}
+	p, ok := DetachPrincipal(request.Context())
+	if !ok {
+		Logger(request.Context()).Warn("anonymous request on restricted handler", "method", request.Method, "url", request.URL)
+		writeProblem(writer, request, http.StatusUnauthorized, "authentication required")
+		return false
+	}
+	for _, hr := range requirements {
+		if err := hr.Requirement().check(request.Context(), p, request); err != nil {
+			Logger(request.Context()).Warn("forbidden request", "err", err, "subject", p.Subject, "method", request.Method, "url", request.URL)
+			writeProblem(writer, request, http.StatusForbidden, err.Error())
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package wf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuthorize(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	principals := map[string]*Principal{
+		"admin":  {Subject: "alice", Roles: []string{"admin"}},
+		"reader": {Subject: "bob", Roles: []string{"user"}, Scopes: []string{"items:read"}},
+		"writer": {Subject: "carol", Roles: []string{"user"}, Scopes: []string{"items:read", "items:write"}},
+	}
+	ok := func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		return []byte("ok"), nil
+	}
+	notBob := func(_ context.Context, p *Principal, _ *http.Request) error {
+		if p.Subject == "bob" {
+			return errors.New("not for bob")
+		}
+		return nil
+	}
+	web := NewWeb(false,
+		RequireRoles(NewEchoHandler("/admin", 0, ok), "admin", "root"),
+		RequireScopes(RequireRoles(NewEchoHandler("/write", 0, ok), "user"), "items:read", "items:write"),
+		RequirePolicy(NewEchoHandler("/policy", 0, ok), "notBob", notBob),
+		NewEchoHandler("/open", 0, ok),
+	)
+	web.SetAuthenticator(Optional(TokenAuth(func(_ context.Context, credential string) (*Principal, error) {
+		return principals[credential], nil
+	})))
+
+	tests := []struct {
+		name   string
+		target string
+		token  string
+		status int
+		detail string
+	}{
+		{"admin", "/admin", "admin", http.StatusOK, ""},
+		{"not admin", "/admin", "reader", http.StatusForbidden, "requires any role of [admin root]"},
+		{"anonymous", "/admin", "", http.StatusUnauthorized, "authentication required"},
+		{"writer", "/write", "writer", http.StatusOK, ""},
+		{"reader", "/write", "reader", http.StatusForbidden, "requires scope items:write"},
+		{"admin without scopes", "/write", "admin", http.StatusForbidden, "requires scope items:read"},
+		{"policy", "/policy", "writer", http.StatusOK, ""},
+		{"policy denied", "/policy", "reader", http.StatusForbidden, "not for bob"},
+		{"open", "/open", "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.token != "" {
+				req.Header.Set("Token", tt.token)
+			}
+			recorder := httptest.NewRecorder()
+			web.ServeHTTP(recorder, req)
+			if recorder.Code != tt.status {
+				t.Fatalf("want %d, got %d %q", tt.status, recorder.Code, recorder.Body.String())
+			}
+			if tt.status == http.StatusOK {
+				return
+			}
+			if ct := recorder.Header().Get("Content-Type"); ct != ProblemContentType {
+				t.Errorf("want content type %q, got %q", ProblemContentType, ct)
+			}
+			var problem Problem
+			if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+				t.Fatal(err)
+			}
+			if problem.Status != tt.status || problem.Detail != tt.detail {
+				t.Errorf("want %d %q, got %+v", tt.status, tt.detail, problem)
+			}
+		})
+	}
+}
+
+func TestRequirementInRoutes(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	h := RequireScopes(RequireRoles(NewEchoHandler("/write", 0, nil), "user", "admin"), "items:write")
+	web := NewWeb(false, NewGroup("/v1").Handle(h).Handlers()...)
+
+	routes := web.Routes()
+	if len(routes) != 1 || len(routes[0].Requirements) != 2 || routes[0].Pattern.Path != "/v1/write" {
+		t.Fatalf("unexpected routes %+v", routes)
+	}
+	data, err := json.Marshal(routes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `"requirements":[{"scopes":["items:write"]},{"roles":["user","admin"]}]`
+	if !strings.Contains(string(data), want) {
+		t.Errorf("want %s in %s", want, data)
+	}
+
+	var sb strings.Builder
+	if err := web.PrintRoutes(&sb); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sb.String(), "scope:items:write role:user|admin") {
+		t.Errorf("want requirements in table\n%s", sb.String())
+	}
+}
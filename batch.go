@@ -0,0 +1,202 @@
+package wf
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// BatchRequest is one of the sub-requests sent to a [BatchHandler] as a JSON array.
+type BatchRequest struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"` // with the query, if any
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"` // sent as JSON
+}
+
+// BatchResponse is the result of a [BatchRequest], in the same order,
+// whose Body is embedded as JSON if it's JSON, or a string otherwise.
+type BatchResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// Batch configures [NewBatchHandler].
+type Batch struct {
+	// MaxRequests bounds sub-requests of a batch, zero as 20.
+	MaxRequests int
+	// Concurrency is the max sub-requests served at the same time, zero or one as one by one in order.
+	Concurrency int
+}
+
+// callerHeaders are copied from a batch to its sub-requests in place of their own,
+// which carry the caller's identity and address, so that a sub-request never claims another one.
+var callerHeaders = []string{"Token", "Authorization", "Cookie",
+	"Forwarded", "X-Forwarded-For", "X-Forwarded-Host", "X-Forwarded-Proto", "X-Real-IP"}
+
+// BatchHandler serves a JSON array of [BatchRequest] in one call, each through the [Web] it's registered in
+// as if sent alone, with its authentication, middlewares and handlers, and the caller's auth and forwarding headers.
+// Sub-requests share the timeout of BatchHandler as a deadline, and ones not started by then are 504.
+// They are counted against the slot or token the batch took of a [ConcurrencyLimiter] or [RateLimiter],
+// rather than take their own, and any batch among them is rejected as nested.
+type BatchHandler struct {
+	*MountedHandler
+	config Batch
+	web    *Web
+}
+
+func NewBatchHandler(matcher CanMatch, config Batch) *BatchHandler {
+	bh := &BatchHandler{config: config}
+	bh.MountedHandler = Mount(matcher, http.HandlerFunc(bh.serveBatch))
+	return bh
+}
+
+func (bh *BatchHandler) bindWeb(w *Web) {
+	bh.web = w
+}
+
+// batchSubValue marks a sub-request of a batch, with the limiters that admitted the batch.
+var batchSubValue = NewContextValue[[]any]("batch sub-request")
+
+// admittedValue lists the limiters that admitted a request.
+var admittedValue = NewContextValue[[]any]("admitted by limiters")
+
+// admittedByBatch tells whether request is a sub-request of a batch that limiter admitted,
+// or records that limiter admits request otherwise.
+func admittedByBatch(request *http.Request, limiter any) (*http.Request, bool) {
+	ctx := request.Context()
+	if limiters, _ := batchSubValue.Detach(ctx); slices.Contains(limiters, limiter) {
+		return request, true
+	}
+	limiters, _ := admittedValue.Detach(ctx)
+	return request.WithContext(admittedValue.Attach(ctx, append(slices.Clip(limiters), limiter))), false
+}
+
+// withoutValues keeps the deadline and cancellation of a context, but none of its request-scoped values,
+// such as the route, principal and token of a batch, which its sub-requests must not inherit.
+type withoutValues struct {
+	context.Context
+}
+
+func (withoutValues) Value(any) any {
+	return nil
+}
+
+func (bh *BatchHandler) serveBatch(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	logger := Logger(ctx)
+	if bh.web == nil {
+		writeProblem(writer, request, http.StatusInternalServerError, "batch handler not registered")
+		return
+	}
+	if _, ok := batchSubValue.Detach(ctx); ok {
+		writeProblem(writer, request, http.StatusBadRequest, "nested batch")
+		return
+	}
+	var subs []BatchRequest
+	if err := json.NewDecoder(request.Body).Decode(&subs); err != nil {
+		logger.Warn("bad batch format", "err", err)
+		writeProblem(writer, request, http.StatusBadRequest, "can not parse batch as "+err.Error())
+		return
+	}
+	if limit := cmp.Or(bh.config.MaxRequests, 20); len(subs) > limit {
+		writeProblem(writer, request, http.StatusRequestEntityTooLarge, fmt.Sprintf("batch over %d requests", limit))
+		return
+	}
+
+	responses := make([]BatchResponse, len(subs))
+	sem := make(chan struct{}, max(bh.config.Concurrency, 1))
+	var wg sync.WaitGroup
+	for i, sub := range subs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			for j := i; j < len(subs); j++ {
+				responses[j] = BatchResponse{Status: http.StatusGatewayTimeout}
+			}
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			responses[i] = bh.serveSub(request, i, sub)
+		}()
+	}
+	wg.Wait()
+
+	data, err := json.Marshal(responses)
+	if err != nil {
+		logger.Error("unexpected failure on marshal", "err", err)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", JSONContentType)
+	_, _ = writer.Write(data)
+}
+
+// serveSub serves the ith sub-request of batch through the Web.
+func (bh *BatchHandler) serveSub(batch *http.Request, i int, sub BatchRequest) BatchResponse {
+	ctx := batch.Context()
+	limiters, _ := admittedValue.Detach(ctx)
+	subCtx := batchSubValue.Attach(withoutValues{ctx}, limiters)
+	if clock, ok := clockValue.Detach(ctx); ok {
+		subCtx = clockValue.Attach(subCtx, clock)
+	}
+	request, err := http.NewRequestWithContext(subCtx, cmp.Or(sub.Method, http.MethodGet), sub.Path, bytes.NewReader(sub.Body))
+	if err != nil || request.URL.Path == "" || request.URL.Host != "" {
+		return batchError(http.StatusBadRequest, fmt.Sprintf("invalid sub-request %s %q", sub.Method, sub.Path))
+	}
+	for name, value := range sub.Headers {
+		request.Header.Set(name, value)
+	}
+	if len(sub.Body) > 0 && request.Header.Get("Content-Type") == "" {
+		request.Header.Set("Content-Type", JSONContentType)
+	}
+	for _, name := range callerHeaders {
+		request.Header.Del(name)
+		for _, value := range batch.Header.Values(name) {
+			request.Header.Add(name, value)
+		}
+	}
+	if id, ok := DetachRequestID(ctx); ok {
+		request.Header.Set(RequestIDHeader, id+"."+strconv.Itoa(i))
+	}
+	if sc, ok := DetachSpanContext(ctx); ok && sc.IsValid() {
+		injectTrace(request.Header, sc)
+	}
+	request.RemoteAddr = batch.RemoteAddr
+	request.Host = batch.Host
+
+	cw := capture(&discardWriter{header: http.Header{}})
+	bh.web.ServeHTTP(cw, request)
+	status, header := cw.captured()
+	response := BatchResponse{Status: status, Headers: map[string]string{}}
+	for name := range header {
+		response.Headers[name] = header.Get(name)
+	}
+	body := cw.body.Bytes()
+	switch mt, _, _ := mime.ParseMediaType(header.Get("Content-Type")); {
+	case len(body) == 0:
+	case (mt == "application/json" || mt == ProblemContentType) && json.Valid(body):
+		response.Body = body
+	default:
+		response.Body, _ = json.Marshal(string(body))
+	}
+	return response
+}
+
+func batchError(status int, detail string) BatchResponse {
+	body, _ := json.Marshal(Problem{Title: http.StatusText(status), Status: status, Detail: detail})
+	return BatchResponse{Status: status, Headers: map[string]string{"Content-Type": ProblemContentType}, Body: body}
+}
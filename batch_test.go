@@ -0,0 +1,207 @@
+package wf
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBatchHandler(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	web := NewWeb(false,
+		NewBatchHandler(Exact(http.MethodPost, "/batch"), Batch{}),
+		NewEchoHandler("/whoami", 0, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+			token, _ := DetachToken(ctx)
+			id, _ := DetachRequestID(ctx)
+			return []byte(token + " " + id), nil
+		}),
+		NewJSONHandler(Exact(http.MethodPost, "/sum"), reflect.TypeOf(sumReq{}), func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+			r := req.(*sumReq)
+			return map[string]int{"sum": r.A + r.B}, nil
+		}),
+	)
+	body := `[
+		{"method":"GET","path":"/whoami","headers":{"Token":"forged"}},
+		{"method":"POST","path":"/sum","body":{"A":1,"B":2}},
+		{"method":"GET","path":"/missing"},
+		{"method":"POST","path":"/batch","body":[]},
+		{"method":"GET","path":"http://elsewhere/whoami"}
+	]`
+	request := httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body))
+	request.Header.Set("Token", "t1")
+	request.Header.Set(RequestIDHeader, "r1")
+	recorder := httptest.NewRecorder()
+	web.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("want 200, got %d %s", recorder.Code, recorder.Body)
+	}
+	var responses []BatchResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &responses); err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		status int
+		body   string
+	}{
+		{http.StatusOK, `"t1 r1.0"`},
+		{http.StatusOK, `{"sum":3}`},
+		{http.StatusNotAcceptable, `"unsupported request on GET /missing"`},
+		{http.StatusBadRequest, `{"title":"Bad Request","status":400,"detail":"nested batch","requestId":"r1.3"}`},
+		{http.StatusBadRequest, `{"title":"Bad Request","status":400,"detail":"invalid sub-request GET \"http://elsewhere/whoami\""}`},
+	}
+	if len(responses) != len(want) {
+		t.Fatalf("want %d responses, got %s", len(want), recorder.Body)
+	}
+	for i, w := range want {
+		if responses[i].Status != w.status || string(responses[i].Body) != w.body {
+			t.Errorf("%d: want %d %s, got %d %s", i, w.status, w.body, responses[i].Status, responses[i].Body)
+		}
+	}
+	if responses[1].Headers["Content-Type"] != JSONContentType {
+		t.Errorf("want headers, got %v", responses[1].Headers)
+	}
+}
+
+func TestBatchConcurrencyAndDeadline(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	var inFlight, peak atomic.Int32
+	slow := NewEchoHandler("/slow", 0, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(20 * time.Millisecond)
+		return []byte("ok"), nil
+	})
+	subs := `[` + strings.Repeat(`{"path":"/slow"},`, 5) + `{"path":"/slow"}]`
+	tests := []struct {
+		name     string
+		batch    Batch
+		timeout  time.Duration
+		peak     int32
+		timeouts int // at least
+	}{
+		{"parallel", Batch{Concurrency: 2}, time.Second, 2, 0},
+		{"sequential with deadline", Batch{}, 50 * time.Millisecond, 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peak.Store(0)
+			bh := NewBatchHandler(Exact(http.MethodPost, "/batch"), tt.batch)
+			bh.Timeout = tt.timeout
+			web := NewWeb(false, bh, slow)
+			recorder := httptest.NewRecorder()
+			web.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(subs)))
+			var responses []BatchResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &responses); err != nil {
+				t.Fatal(err)
+			}
+			timeouts := 0
+			for _, r := range responses {
+				if r.Status != http.StatusOK {
+					timeouts++
+				}
+			}
+			if peak.Load() != tt.peak || timeouts < tt.timeouts || responses[0].Status != http.StatusOK {
+				t.Errorf("want peak %d and %d timeouts, got %d and %d: %s", tt.peak, tt.timeouts, peak.Load(), timeouts, recorder.Body)
+			}
+		})
+	}
+}
+
+func TestBatchSubRequestsKeepCallerAddress(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	web := NewWeb(false,
+		NewBatchHandler(Exact(http.MethodPost, "/batch"), Batch{Concurrency: 1}),
+		WithMiddlewares(NewEchoHandler("/limited", 0, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+			return []byte("ok"), nil
+		}), RateLimiter(RateLimit{Limit: 1, Window: time.Minute, Key: KeyByIP("X-Forwarded-For")})),
+	)
+	body := `[
+		{"method":"GET","path":"/limited","headers":{"X-Forwarded-For":"10.0.0.1"}},
+		{"method":"GET","path":"/limited","headers":{"X-Forwarded-For":"10.0.0.2"}}
+	]`
+	request := httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body))
+	request.Header.Set("X-Forwarded-For", "1.2.3.4")
+	recorder := httptest.NewRecorder()
+	web.ServeHTTP(recorder, request)
+	var responses []BatchResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &responses); err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 2 || responses[0].Status != http.StatusOK || responses[1].Status != http.StatusTooManyRequests {
+		t.Errorf("want sub-requests limited as the caller, got %s", recorder.Body)
+	}
+}
+
+func TestBatchCountedAgainstItsLimiters(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	web := NewWeb(false,
+		NewBatchHandler(Exact(http.MethodPost, "/batch"), Batch{Concurrency: 2}),
+		NewEchoHandler("/ok", 0, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+			return []byte("ok"), nil
+		}),
+	)
+	web.Use(ConcurrencyLimiter(ConcurrencyLimit{Limit: 1}), RateLimiter(RateLimit{Limit: 1, Window: time.Minute}))
+	recorder := httptest.NewRecorder()
+	web.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(`[{"path":"/ok"},{"path":"/ok"}]`)))
+	var responses []BatchResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &responses); err != nil {
+		t.Fatalf("want responses, got %d %s", recorder.Code, recorder.Body)
+	}
+	for i, r := range responses {
+		if r.Status != http.StatusOK {
+			t.Errorf("%d: want sub-requests admitted with the batch, got %d %s", i, r.Status, r.Body)
+		}
+	}
+
+	recorder = httptest.NewRecorder()
+	web.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ok", nil))
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Errorf("want the batch counted once, then limited, got %d", recorder.Code)
+	}
+}
+
+func TestBatchSubRequestsDropBatchContext(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	verify := func(_ context.Context, credential string) (*Principal, error) {
+		return &Principal{Subject: "alice"}, nil
+	}
+	web := NewWeb(false,
+		WithAuthenticator(NewBatchHandler(Exact(http.MethodPost, "/batch"), Batch{}), TokenAuth(verify)),
+		NewBatchHandler(Exact(http.MethodPost, "/other-batch"), Batch{}),
+		NewEchoHandler("/whoami", 0, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+			_, authenticated := DetachPrincipal(ctx)
+			route, _ := DetachRoute(ctx)
+			return []byte(fmt.Sprintf("%t %s", authenticated, route.Pattern.Path)), nil
+		}),
+	)
+	body := `[{"path":"/whoami"},{"method":"POST","path":"/other-batch","body":[{"path":"/whoami"}]}]`
+	request := httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body))
+	request.Header.Set("Token", "t1")
+	recorder := httptest.NewRecorder()
+	web.ServeHTTP(recorder, request)
+	var responses []BatchResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &responses); err != nil {
+		t.Fatalf("want responses, got %d %s", recorder.Code, recorder.Body)
+	}
+	if len(responses) != 2 || string(responses[0].Body) != `"false /whoami"` {
+		t.Errorf("want no principal or route of the batch, got %s", recorder.Body)
+	}
+	if len(responses) == 2 && (responses[1].Status != http.StatusBadRequest || !strings.Contains(string(responses[1].Body), "nested batch")) {
+		t.Errorf("want another batch rejected as nested, got %d %s", responses[1].Status, responses[1].Body)
+	}
+}
@@ -0,0 +1,321 @@
+package wf
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheTags tells tags of a request, such as "items" and "item:3", by which cached responses are invalidated.
+type CacheTags func(req *http.Request) []string
+
+// Tags is [CacheTags] of fixed ones.
+func Tags(tags ...string) CacheTags {
+	return func(*http.Request) []string {
+		return tags
+	}
+}
+
+// CachePolicy configures [Cached].
+type CachePolicy struct {
+	TTL time.Duration // how long a response is fresh
+	// StaleWhileRevalidate is how long after TTL a stale response is still served, while refreshed in background.
+	StaleWhileRevalidate time.Duration
+	// Query is the query parameters in the key, nil as the whole query.
+	Query []string
+	// Vary is the request headers in the key, such as Accept-Language, which are also told by the Vary header.
+	Vary []string
+	// Shared makes principals share responses, for ones not depending on who asks.
+	Shared bool
+	Tags   CacheTags // nil as none
+}
+
+// ResponseCache keeps responses in memory for [Cached], evicting the least recently used beyond its bound in bytes.
+type ResponseCache struct {
+	maxBytes int
+
+	mu      sync.Mutex
+	size    int
+	lru     *list.List // of *cacheEntry, the front the most recent
+	entries map[string]*list.Element
+	tags    map[string]map[string]struct{} // tag to keys
+	flights map[string]*cacheFlight
+	// generation increases on every invalidation, so that a response computed before it is not stored.
+	generation uint64
+}
+
+type cacheEntry struct {
+	key    string
+	status int
+	header http.Header
+	body   []byte
+	tags   []string
+	stored time.Time
+	fresh  time.Time // until
+	stale  time.Time // until
+	size   int
+}
+
+// cacheFlight is a miss being served, which concurrent requests of the same key wait for.
+type cacheFlight struct {
+	done       chan struct{}
+	generation uint64      // as of the start
+	entry      *cacheEntry // nil as not cacheable
+}
+
+func NewResponseCache(maxBytes int) *ResponseCache {
+	return &ResponseCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+		tags:     map[string]map[string]struct{}{},
+		flights:  map[string]*cacheFlight{},
+	}
+}
+
+// Invalidate drops responses of any of tags, and ones being computed.
+func (c *ResponseCache) Invalidate(tags ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for _, tag := range tags {
+		for key := range c.tags[tag] {
+			if e, ok := c.entries[key]; ok {
+				c.remove(e)
+			}
+		}
+	}
+}
+
+// Len returns the count of responses kept.
+func (c *ResponseCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Cached serves GET requests from cache, keyed by the route, path, query, Vary headers and principal as policy,
+// where routes of custom matchers are told apart by [RouteID].
+// Only 200 responses without Cache-Control: no-store or private are kept, with the headers set by next
+// except per-request ones, such as CORS and RateLimit.
+// Concurrent misses of one key are coalesced into one, and every response has X-Cache of HIT, STALE or MISS.
+// Use it by [WithMiddlewares] for an expensive handler, and [Invalidating] on handlers that change what it responds.
+func Cached(cache *ResponseCache, policy CachePolicy) Middleware {
+	if policy.TTL <= 0 {
+		panic("cache requires a positive TTL")
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if request.Method != http.MethodGet {
+				next.ServeHTTP(writer, request)
+				return
+			}
+			if len(policy.Vary) > 0 {
+				writer.Header().Add("Vary", strings.Join(policy.Vary, ", "))
+			}
+			key := policy.key(request)
+			ctx := request.Context()
+			now := Now(ctx)
+
+			cache.mu.Lock()
+			if el, ok := cache.entries[key]; ok {
+				e := el.Value.(*cacheEntry)
+				if now.Before(e.fresh) {
+					cache.lru.MoveToFront(el)
+					cache.mu.Unlock()
+					e.replay(writer, now, "HIT")
+					return
+				}
+				if now.Before(e.stale) {
+					cache.lru.MoveToFront(el)
+					if _, ok := cache.flights[key]; !ok {
+						flight := cache.begin(key)
+						go cache.refresh(key, flight, next, request.Clone(context.WithoutCancel(ctx)), policy)
+					}
+					cache.mu.Unlock()
+					e.replay(writer, now, "STALE")
+					return
+				}
+			}
+			if flight, ok := cache.flights[key]; ok {
+				cache.mu.Unlock()
+				select {
+				case <-flight.done:
+					if flight.entry != nil {
+						flight.entry.replay(writer, now, "HIT")
+						return
+					}
+				case <-ctx.Done():
+					writeProblem(writer, request, http.StatusServiceUnavailable, "cache fill canceled")
+					return
+				}
+				writer.Header().Set("X-Cache", "MISS")
+				next.ServeHTTP(writer, request)
+				return
+			}
+			flight := cache.begin(key)
+			cache.mu.Unlock()
+
+			writer.Header().Set("X-Cache", "MISS")
+			cw := capture(writer)
+			completed := false
+			defer func() {
+				// Also on panic, which is recovered by Web outside.
+				cache.end(key, flight, cw, request, policy, completed)
+			}()
+			next.ServeHTTP(cw, request)
+			completed = true
+		})
+	}
+}
+
+// Invalidating makes successful requests invalidate responses of their tags, such as by a handler updating an item.
+func Invalidating(cache *ResponseCache, tags CacheTags) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			next.ServeHTTP(writer, request)
+			if rw, ok := recordingWriter(writer); ok && rw.status >= http.StatusBadRequest {
+				return
+			}
+			cache.Invalidate(tags(request)...)
+		})
+	}
+}
+
+func (p *CachePolicy) key(request *http.Request) string {
+	var b strings.Builder
+	route, _ := DetachRoute(request.Context())
+	b.WriteString(route.Pattern.Method + " " + route.label() + "|" + request.URL.Path + "?")
+	if p.Query == nil {
+		b.WriteString(request.URL.Query().Encode()) // sorted
+	} else {
+		query, selected := request.URL.Query(), url.Values{}
+		for _, name := range p.Query {
+			if values, ok := query[name]; ok {
+				selected[name] = values
+			}
+		}
+		b.WriteString(selected.Encode())
+	}
+	for _, name := range p.Vary {
+		b.WriteString("|" + strings.Join(request.Header.Values(name), ","))
+	}
+	if !p.Shared {
+		b.WriteString("|")
+		if principal, ok := DetachPrincipal(request.Context()); ok {
+			b.WriteString(principal.Subject)
+		}
+	}
+	return b.String()
+}
+
+// begin starts a flight of key, which must be called with mu locked.
+func (c *ResponseCache) begin(key string) *cacheFlight {
+	flight := &cacheFlight{done: make(chan struct{}), generation: c.generation}
+	c.flights[key] = flight
+	return flight
+}
+
+// end stores what's captured by cw if completed and cacheable, and completes the flight.
+func (c *ResponseCache) end(key string, flight *cacheFlight, cw *capturingWriter, request *http.Request, policy CachePolicy, completed bool) {
+	defer func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.flights, key)
+		close(flight.done)
+	}()
+	status, header := cw.captured()
+	if !completed || status != http.StatusOK || !storable(header) {
+		return
+	}
+	now := Now(request.Context())
+	e := &cacheEntry{
+		key:    key,
+		status: status,
+		header: replayable(header),
+		body:   cw.body.Bytes(),
+		stored: now,
+		fresh:  now.Add(policy.TTL),
+		stale:  now.Add(policy.TTL + policy.StaleWhileRevalidate),
+	}
+	if policy.Tags != nil {
+		e.tags = policy.Tags(request)
+	}
+	e.size = len(key) + len(e.body)
+	for name, values := range header {
+		e.size += len(name)
+		for _, v := range values {
+			e.size += len(v)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != flight.generation {
+		return
+	}
+	flight.entry = e
+	if e.size > c.maxBytes {
+		return
+	}
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	c.size += e.size
+	for _, tag := range e.tags {
+		if c.tags[tag] == nil {
+			c.tags[tag] = map[string]struct{}{}
+		}
+		c.tags[tag][key] = struct{}{}
+	}
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+// refresh serves request in background to replace a stale response.
+func (c *ResponseCache) refresh(key string, flight *cacheFlight, next http.Handler, request *http.Request, policy CachePolicy) {
+	cw := capture(&discardWriter{header: http.Header{}})
+	completed := false
+	defer func() {
+		if p := recover(); p != nil {
+			Logger(request.Context()).Error("panic on cache refresh", "panic", p)
+		}
+		c.end(key, flight, cw, request, policy, completed)
+	}()
+	next.ServeHTTP(cw, request)
+	completed = true
+}
+
+// remove drops el, which must be called with mu locked.
+func (c *ResponseCache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, e.key)
+	c.size -= e.size
+	for _, tag := range e.tags {
+		delete(c.tags[tag], e.key)
+		if len(c.tags[tag]) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+}
+
+func (e *cacheEntry) replay(writer http.ResponseWriter, now time.Time, state string) {
+	writer.Header().Set("X-Cache", state)
+	writer.Header().Set("Age", strconv.Itoa(int(max(now.Sub(e.stored), 0)/time.Second)))
+	replay(writer, e.status, e.header, e.body)
+}
+
+func storable(header http.Header) bool {
+	for _, directive := range strings.Split(strings.ToLower(header.Get("Cache-Control")), ",") {
+		if d := strings.TrimSpace(directive); d == "no-store" || d == "private" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,211 @@
+package wf
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCached(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	var calls atomic.Int32
+	cache := NewResponseCache(1 << 20)
+	items := NewEchoHandler("/items", 0, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		n := calls.Add(1)
+		return []byte("items " + strconv.Itoa(int(n))), nil
+	})
+	update := NewClosureHandler(Exact(http.MethodPost, "/items"), ParseEmpty,
+		func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+			return []byte("updated"), nil
+		},
+		func(output any) ([]byte, error) {
+			return output.([]byte), nil
+		},
+		"text/plain")
+	web := NewWeb(false,
+		WithMiddlewares(items, Cached(cache, CachePolicy{
+			TTL:                  time.Minute,
+			StaleWhileRevalidate: time.Minute,
+			Vary:                 []string{"Accept-Language"},
+			Tags:                 Tags("items"),
+		})),
+		WithMiddlewares(update, Invalidating(cache, Tags("items"))),
+	)
+	now := time.Unix(1_700_000_000, 0)
+	server := withClock(web, &now)
+	get := func(target, language string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, target, nil)
+		request.Header.Set("Accept-Language", language)
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	steps := []struct {
+		advance time.Duration
+		target  string
+		lang    string
+		cache   string
+		body    string
+	}{
+		{0, "/items", "en", "MISS", "items 1"},
+		{10 * time.Second, "/items", "en", "HIT", "items 1"},
+		{0, "/items?page=2", "en", "MISS", "items 2"},
+		{0, "/items", "fr", "MISS", "items 3"},
+		{70 * time.Second, "/items", "en", "STALE", "items 1"},
+	}
+	for i, s := range steps {
+		now = now.Add(s.advance)
+		r := get(s.target, s.lang)
+		if r.Code != http.StatusOK || r.Header().Get("X-Cache") != s.cache || r.Body.String() != s.body {
+			t.Errorf("step %d: want %s %q, got %d %s %q", i, s.cache, s.body, r.Code, r.Header().Get("X-Cache"), r.Body)
+		}
+	}
+	if r := get("/items", "en"); r.Header().Get("Vary") != "Accept-Language" || r.Header().Get("Age") == "" {
+		t.Errorf("want Vary and Age, got %v", r.Header())
+	}
+
+	for calls.Load() != 4 || cache.Len() != 3 {
+		time.Sleep(time.Millisecond) // until refreshed in background
+	}
+	if r := get("/items", "en"); r.Body.String() != "items 4" {
+		t.Errorf("want refreshed in background, got %q", r.Body)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/items", nil))
+	if cache.Len() != 0 {
+		t.Errorf("want invalidated, got %d kept", cache.Len())
+	}
+	if r := get("/items", "en"); r.Header().Get("X-Cache") != "MISS" || r.Body.String() != "items 5" {
+		t.Errorf("want miss once invalidated, got %s %q", r.Header().Get("X-Cache"), r.Body)
+	}
+}
+
+func TestCachedCoalescing(t *testing.T) {
+	var calls atomic.Int32
+	started, release := make(chan struct{}), make(chan struct{})
+	cache := NewResponseCache(1 << 20)
+	web := NewWeb(false, WithMiddlewares(NewEchoHandler("/slow", 0, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		if calls.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return []byte("slow"), nil
+	}), Cached(cache, CachePolicy{TTL: time.Minute})))
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 5)
+	for i := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recorder := httptest.NewRecorder()
+			web.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/slow", nil))
+			bodies[i] = recorder.Body.String()
+		}()
+		if i == 0 {
+			<-started
+		}
+	}
+	time.Sleep(10 * time.Millisecond) // for the others to wait, or hit if late
+	close(release)
+	wg.Wait()
+	if calls.Load() != 1 {
+		t.Errorf("want one call for concurrent misses, got %d", calls.Load())
+	}
+	for i, body := range bodies {
+		if body != "slow" {
+			t.Errorf("%d: unexpected %q", i, body)
+		}
+	}
+}
+
+func TestResponseCacheEviction(t *testing.T) {
+	cache := NewResponseCache(200)
+	web := NewWeb(false, WithMiddlewares(NewEchoHandler("/data", 0, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		return make([]byte, 30), nil
+	}), Cached(cache, CachePolicy{TTL: time.Minute, Query: []string{"id"}})))
+	get := func(target string) string {
+		recorder := httptest.NewRecorder()
+		web.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		return recorder.Header().Get("X-Cache")
+	}
+	get("/data?id=1")
+	get("/data?id=2")
+	get("/data?id=1&ignored=x") // touches 1
+	get("/data?id=3")
+	if cache.Len() != 2 {
+		t.Errorf("want bounded by bytes, got %d kept", cache.Len())
+	}
+	if got := get("/data?id=1"); got != "HIT" {
+		t.Errorf("want the recent kept, got %s", got)
+	}
+	if got := get("/data?id=2"); got != "MISS" {
+		t.Errorf("want the least recent evicted, got %s", got)
+	}
+}
+
+func TestCachedStoresOnlyResponseHeaders(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	cache := NewResponseCache(1 << 20)
+	web := NewWeb(true, WithMiddlewares(NewEchoHandler("/items", 0, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		return []byte("items"), nil
+	}), Cached(cache, CachePolicy{TTL: time.Minute, Shared: true}), RateLimiter(RateLimit{Limit: 10, Window: time.Minute})))
+	get := func(origin string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/items", nil)
+		request.Header.Set("Origin", origin)
+		web.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if first := get("https://a.example"); first.Header().Get("RateLimit-Remaining") != "9" {
+		t.Fatalf("want rate limited, got %v", first.Header())
+	}
+	hit := get("https://b.example")
+	if hit.Header().Get("X-Cache") != "HIT" || hit.Header().Get("Content-Type") != "text/plain" {
+		t.Fatalf("want a hit with its content type, got %v", hit.Header())
+	}
+	if got := hit.Header().Get("Access-Control-Allow-Origin"); got != "https://b.example" {
+		t.Errorf("want CORS of the hit, got %q", got)
+	}
+	if got := hit.Header().Get("RateLimit-Remaining"); got != "" {
+		t.Errorf("want rate limit headers of the miss not stored, got %q", got)
+	}
+}
+
+func TestCachedKeysOpaqueRoutesApart(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	cache := NewResponseCache(1 << 20)
+	policy := CachePolicy{TTL: time.Minute, Shared: true}
+	// Both from one factory, so that the handlers have the same name.
+	variant := func(value string) Handler {
+		return WithMiddlewares(NewClosureHandler(MatchFunc(func(req *http.Request) bool {
+			return req.Method == http.MethodGet && req.Header.Get("X-Variant") == value
+		}), ParseEmpty, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+			return []byte(value), nil
+		}, func(output any) ([]byte, error) {
+			return output.([]byte), nil
+		}, "text/plain"), Cached(cache, policy))
+	}
+	web := NewWeb(false, variant("a"), variant("b"))
+	for _, value := range []string{"a", "b"} {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/items", nil)
+		request.Header.Set("X-Variant", value)
+		web.ServeHTTP(recorder, request)
+		if recorder.Body.String() != value {
+			t.Errorf("want %q, got %s %q", value, recorder.Header().Get("X-Cache"), recorder.Body)
+		}
+	}
+}
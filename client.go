@@ -0,0 +1,82 @@
+package wf
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Client is the runtime of typed clients generated by cmd/wfclient.
+// It could also be used directly to call a JSON [Handler] served by [Web].
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// Header is sent with every call, such as the Token used by [AttachToken].
+	Header http.Header
+}
+
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: cmp.Or(httpClient, http.DefaultClient),
+		Header:     http.Header{},
+	}
+}
+
+// Call sends req as JSON to method path, and decodes the response into rsp.
+// A nil req sends no body, a nil rsp discards the response body.
+// Any non-2XX response is returned as a *[CodedError], whose Err is the response body,
+// which is what [Web] writes on a failed Handle.
+func (c *Client) Call(ctx context.Context, method string, path string, req any, rsp any) error {
+	var body io.Reader
+	if req != nil {
+		data, err := json.Marshal(req)
+		if err != nil {
+			return fmt.Errorf("marshal req: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	for k, vs := range c.Header {
+		request.Header[k] = vs
+	}
+	if id, ok := DetachRequestID(ctx); ok && request.Header.Get(RequestIDHeader) == "" {
+		request.Header.Set(RequestIDHeader, id)
+	}
+	if sc, ok := DetachSpanContext(ctx); ok && request.Header.Get("traceparent") == "" {
+		injectTrace(request.Header, sc)
+	}
+	if req != nil {
+		request.Header.Set("Content-Type", JSONContentType)
+	}
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("read rsp: %w", err)
+	}
+	if response.StatusCode/100 != 2 {
+		return NewCodedError(response.StatusCode, errors.New(string(data)))
+	}
+	if rsp == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, rsp); err != nil {
+		return fmt.Errorf("unmarshal rsp: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+const wfImportPath = "github.com/hyisen/wf"
+
+// endpoint is a recognized handler registration.
+type endpoint struct {
+	Name     string
+	Method   string // as an expression, such as http.MethodPost
+	Verb     string // as the value, such as POST
+	Path     string
+	Request  string // empty as no request body
+	Response string // without pointer
+}
+
+// Generate parses the non-test go files in dir except output, and returns the formatted client source.
+func Generate(dir string, typeName string, output string) ([]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") || name == output {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no go files in %s", dir)
+	}
+
+	g := &generator{funcs: map[string]*ast.FuncDecl{}, imports: map[string]bool{}}
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			if fd, ok := decl.(*ast.FuncDecl); ok && fd.Recv == nil {
+				g.funcs[fd.Name.Name] = fd
+			}
+		}
+	}
+	for _, file := range files {
+		g.inspect(fset, file)
+	}
+	if len(g.endpoints) == 0 {
+		return nil, fmt.Errorf("no NewJSONHandler registration with Exact matcher found in %s", dir)
+	}
+
+	std, others := g.sortedImports()
+	var buf bytes.Buffer
+	err = clientTemplate.Execute(&buf, struct {
+		Package      string
+		Type         string
+		StdImports   []string
+		OtherImports []string
+		Endpoints    []endpoint
+	}{files[0].Name.Name, typeName, std, others, g.endpoints})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+type generator struct {
+	funcs     map[string]*ast.FuncDecl
+	imports   map[string]bool
+	endpoints []endpoint
+	names     []string
+}
+
+// sortedImports returns standard imports, and then the others, in goimports style.
+func (g *generator) sortedImports() (std []string, others []string) {
+	std = []string{"context", "net/http"}
+	others = []string{wfImportPath}
+	for path := range g.imports {
+		if slices.Contains(std, path) || slices.Contains(others, path) {
+			continue
+		}
+		if strings.Contains(strings.Split(path, "/")[0], ".") {
+			others = append(others, path)
+		} else {
+			std = append(std, path)
+		}
+	}
+	slices.Sort(std)
+	slices.Sort(others)
+	return std, others
+}
+
+func (g *generator) inspect(fset *token.FileSet, file *ast.File) {
+	imports := fileImports(file)
+	// Variable names are collected first, so that an assigned handler could be named after it.
+	assigned := map[*ast.CallExpr]string{}
+	ast.Inspect(file, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.AssignStmt:
+			for i, rhs := range n.Rhs {
+				if call, ok := rhs.(*ast.CallExpr); ok && i < len(n.Lhs) {
+					if ident, ok := n.Lhs[i].(*ast.Ident); ok {
+						assigned[call] = ident.Name
+					}
+				}
+			}
+		case *ast.ValueSpec:
+			for i, value := range n.Values {
+				if call, ok := value.(*ast.CallExpr); ok && i < len(n.Names) {
+					assigned[call] = n.Names[i].Name
+				}
+			}
+		}
+		return true
+	})
+	ast.Inspect(file, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok || !isWF(call.Fun, imports, "NewJSONHandler") || len(call.Args) != 3 {
+			return true
+		}
+		ep, err := g.endpoint(call, imports, assigned[call])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wfclient: skip %v: %v\n", fset.Position(call.Pos()), err)
+			return true
+		}
+		g.endpoints = append(g.endpoints, ep)
+		return true
+	})
+}
+
+func (g *generator) endpoint(call *ast.CallExpr, imports map[string]string, variable string) (endpoint, error) {
+	var ep endpoint
+	matcher, ok := call.Args[0].(*ast.CallExpr)
+	if !ok || !isWF(matcher.Fun, imports, "Exact") || len(matcher.Args) != 2 {
+		return ep, fmt.Errorf("matcher is not an Exact call")
+	}
+	method, err := methodExpr(matcher.Args[0])
+	if err != nil {
+		return ep, err
+	}
+	ep.Method = method
+	ep.Verb = strings.ToUpper(strings.TrimPrefix(strings.Trim(method, `"`), "http.Method"))
+	lit, ok := matcher.Args[1].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return ep, fmt.Errorf("path is not a string literal")
+	}
+	ep.Path, _ = strconv.Unquote(lit.Value)
+
+	reqType, err := requestType(call.Args[1])
+	if err != nil {
+		return ep, err
+	}
+	if !isWF(reqType, imports, "Empty") {
+		ep.Request = g.typeString(reqType, imports)
+	}
+
+	ep.Response = "json.RawMessage"
+	var body *ast.BlockStmt
+	switch h := call.Args[2].(type) {
+	case *ast.FuncLit:
+		body = h.Body
+		ep.Name = exported(variable)
+	case *ast.Ident:
+		if fd, ok := g.funcs[h.Name]; ok {
+			body = fd.Body
+		}
+		ep.Name = exported(h.Name)
+	}
+	if t := responseType(body); t != nil {
+		ep.Response = g.typeString(t, imports)
+	} else {
+		g.imports["encoding/json"] = true
+	}
+	if ep.Name == "" {
+		ep.Name = nameFromRoute(ep.Verb, ep.Path)
+	}
+	for slices.Contains(g.names, ep.Name) || slices.Contains(clientMembers, ep.Name) {
+		ep.Name += "_"
+	}
+	g.names = append(g.names, ep.Name)
+	return ep, nil
+}
+
+// clientMembers are the names promoted from the embedded *wf.Client, along with the field itself,
+// which a generated method must not take, or it would shadow them, such as Call that every method uses.
+var clientMembers = []string{"Client", "BaseURL", "HTTPClient", "Header", "Call"}
+
+// typeString renders t as written, and records the import it needs.
+func (g *generator) typeString(t ast.Expr, imports map[string]string) string {
+	if sel, ok := t.(*ast.SelectorExpr); ok {
+		if pkg, ok := sel.X.(*ast.Ident); ok {
+			if path, ok := imports[pkg.Name]; ok {
+				g.imports[path] = true
+			}
+			return pkg.Name + "." + sel.Sel.Name
+		}
+	}
+	var buf bytes.Buffer
+	_ = format.Node(&buf, token.NewFileSet(), t)
+	return buf.String()
+}
+
+// fileImports maps the name used in file to import path.
+func fileImports(file *ast.File) map[string]string {
+	ret := map[string]string{}
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := path[strings.LastIndexByte(path, '/')+1:]
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		ret[name] = path
+	}
+	return ret
+}
+
+// isWF reports whether expr refers to name in wf, either qualified or dot imported.
+func isWF(expr ast.Expr, imports map[string]string, name string) bool {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name == name && imports["."] == wfImportPath
+	case *ast.SelectorExpr:
+		pkg, ok := e.X.(*ast.Ident)
+		return ok && e.Sel.Name == name && imports[pkg.Name] == wfImportPath
+	}
+	return false
+}
+
+func methodExpr(expr ast.Expr) (string, error) {
+	switch e := expr.(type) {
+	case *ast.SelectorExpr:
+		if pkg, ok := e.X.(*ast.Ident); ok && pkg.Name == "http" && strings.HasPrefix(e.Sel.Name, "Method") {
+			return "http." + e.Sel.Name, nil
+		}
+	case *ast.BasicLit:
+		if e.Kind == token.STRING {
+			return e.Value, nil
+		}
+	}
+	return "", fmt.Errorf("method is neither http.MethodX nor a string literal")
+}
+
+// requestType extracts T from reflect.TypeOf(T{}), reflect.TypeOf(&T{}).Elem() or reflect.TypeFor[T]().
+func requestType(expr ast.Expr) (ast.Expr, error) {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok {
+		return nil, fmt.Errorf("request type is not a reflect call")
+	}
+	if sel, ok := call.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Elem" {
+		if inner, ok := sel.X.(*ast.CallExpr); ok {
+			call = inner
+		}
+	}
+	switch fun := call.Fun.(type) {
+	case *ast.SelectorExpr:
+		if fun.Sel.Name == "TypeOf" && len(call.Args) == 1 {
+			if t := compositeType(call.Args[0]); t != nil {
+				return t, nil
+			}
+		}
+	case *ast.IndexExpr:
+		if sel, ok := fun.X.(*ast.SelectorExpr); ok && sel.Sel.Name == "TypeFor" {
+			return fun.Index, nil
+		}
+	}
+	return nil, fmt.Errorf("request type is not reflect.TypeOf(T{}) or reflect.TypeFor[T]()")
+}
+
+// compositeType extracts T from T{} or &T{}.
+func compositeType(expr ast.Expr) ast.Expr {
+	if unary, ok := expr.(*ast.UnaryExpr); ok && unary.Op == token.AND {
+		expr = unary.X
+	}
+	if lit, ok := expr.(*ast.CompositeLit); ok {
+		return lit.Type
+	}
+	return nil
+}
+
+// responseType finds the first composite literal returned as rsp in body.
+func responseType(body *ast.BlockStmt) ast.Expr {
+	if body == nil {
+		return nil
+	}
+	var ret ast.Expr
+	ast.Inspect(body, func(node ast.Node) bool {
+		if ret != nil {
+			return false
+		}
+		if _, ok := node.(*ast.FuncLit); ok {
+			// Returns of a nested func are not of the handler.
+			return false
+		}
+		if rs, ok := node.(*ast.ReturnStmt); ok && len(rs.Results) == 2 {
+			ret = compositeType(rs.Results[0])
+		}
+		return true
+	})
+	return ret
+}
+
+func exported(name string) string {
+	if name == "" || name == "_" {
+		return ""
+	}
+	runes := []rune(name)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+// nameFromRoute converts (GET, "/v1/user-info") to GetV1UserInfo.
+func nameFromRoute(method string, path string) string {
+	var sb strings.Builder
+	sb.WriteString(exported(strings.ToLower(method)))
+	for _, word := range strings.FieldsFunc(path, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		sb.WriteString(exported(word))
+	}
+	return sb.String()
+}
+
+var clientTemplate = template.Must(template.New("client").Parse(`// Code generated by wfclient; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .StdImports}}
+	"{{.}}"
+{{- end}}
+{{range .OtherImports}}
+	"{{.}}"
+{{- end}}
+)
+
+// {{.Type}} is a typed client of the handlers registered in package {{.Package}}.
+// Any non-2XX response is returned as a *wf.CodedError.
+type {{.Type}} struct {
+	*wf.Client
+}
+
+func New{{.Type}}(baseURL string, httpClient *http.Client) *{{.Type}} {
+	return &{{.Type}}{Client: wf.NewClient(baseURL, httpClient)}
+}
+{{range .Endpoints}}
+// {{.Name}} calls {{.Verb}} {{.Path}}.
+func (c *{{$.Type}}) {{.Name}}(ctx context.Context{{if .Request}}, req *{{.Request}}{{end}}) (*{{.Response}}, error) {
+	var rsp {{.Response}}
+	if err := c.Call(ctx, {{.Method}}, "{{.Path}}", {{if .Request}}req{{else}}nil{{end}}, &rsp); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+{{end}}`))
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/hyisen/wf"
+)
+
+// TestGenerateGolden guards that the checked-in generated client in examples is up to date.
+func TestGenerateGolden(t *testing.T) {
+	dir := filepath.Join("..", "..", "examples", "05_client", "api")
+	output := "wfclient_gen.go"
+	got, err := Generate(dir, "Client", output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(filepath.Join(dir, output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("generated client differs from %s, run go generate there\n%s", output, got)
+	}
+}
+
+func TestNameFromRoute(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{"GET", "/v1/user-info", "GetV1UserInfo"},
+		{"POST", "/", "Post"},
+		{"DELETE", "/v1/items/", "DeleteV1Items"},
+	}
+	for _, tt := range tests {
+		if got := nameFromRoute(tt.method, tt.path); got != tt.want {
+			t.Errorf("nameFromRoute(%q, %q) got %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateAvoidsClientMembers(t *testing.T) {
+	dir := t.TempDir()
+	src := `package api
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+
+	"github.com/hyisen/wf"
+)
+
+func call(ctx context.Context, req any) (any, *wf.CodedError) {
+	return nil, nil
+}
+
+func Handlers() []wf.Handler {
+	header := wf.NewJSONHandler(wf.Exact(http.MethodGet, "/header"), reflect.TypeOf(wf.Empty{}), func(ctx context.Context, req any) (any, *wf.CodedError) {
+		return nil, nil
+	})
+	return []wf.Handler{
+		wf.NewJSONHandler(wf.Exact(http.MethodPost, "/call"), reflect.TypeOf(wf.Empty{}), call),
+		header,
+	}
+}
+`
+	if err := os.WriteFile(filepath.Join(dir, "api.go"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Generate(dir, "Client", "wfclient_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Call_", "Header_"} {
+		if !bytes.Contains(got, []byte(") "+name+"(ctx")) {
+			t.Errorf("want method %s renamed from a member of wf.Client\n%s", name, got)
+		}
+	}
+}
+
+// TestClientMembers guards that clientMembers lists every exported member of wf.Client.
+func TestClientMembers(t *testing.T) {
+	want := []string{"Client"}
+	typ := reflect.TypeFor[*wf.Client]()
+	for i := range typ.NumMethod() {
+		want = append(want, typ.Method(i).Name)
+	}
+	for i := range typ.Elem().NumField() {
+		if field := typ.Elem().Field(i); field.IsExported() {
+			want = append(want, field.Name)
+		}
+	}
+	got := slices.Clone(clientMembers)
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
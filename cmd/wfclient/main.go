@@ -0,0 +1,45 @@
+// Command wfclient generates a typed Go client for the JSON handlers registered in a package.
+//
+// It is designed to work with go generate. Put the directive below in the package
+// that registers handlers, and it writes wfclient_gen.go next to it.
+//
+//	//go:generate go run github.com/hyisen/wf/cmd/wfclient
+//
+// A registration is recognized as a NewJSONHandler call, whose matcher is an Exact call
+// and whose request type is given by reflect.TypeOf or reflect.TypeFor, such as
+//
+//	wf.NewJSONHandler(wf.Exact(http.MethodPost, "/v1/greet"), reflect.TypeOf(GreetRequest{}), Greet)
+//
+// As a [wf.HandleFunc] returns any, the response type is inferred from the composite literals
+// returned by the handler, which could be a func literal or a func declared in the package.
+// Once it cannot be inferred, json.RawMessage is used.
+//
+// The client method is named after the handler func, or the variable the handler is assigned to,
+// or at last the method and path, with "_" appended if it's taken by another one or by the embedded *wf.Client,
+// such as Call.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "directory of the package that registers handlers")
+	typeName := flag.String("type", "Client", "name of the generated client type")
+	output := flag.String("output", "wfclient_gen.go", "output file name, relative to dir")
+	flag.Parse()
+
+	data, err := Generate(*dir, *typeName, *output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	path := filepath.Join(*dir, *output)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("wfclient: wrote", path)
+}
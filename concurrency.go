@@ -0,0 +1,181 @@
+package wf
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Priority classes a [Handler] for load shedding, see [WithPriority].
+type Priority int
+
+const (
+	// PriorityLow is rejected at once when the limit is reached, rather than queued.
+	PriorityLow Priority = iota - 1
+	PriorityNormal
+	// PriorityCritical bypasses [ConcurrencyLimiter], such as health checks and admin routes.
+	PriorityCritical
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityCritical:
+		return "critical"
+	}
+	return strconv.Itoa(int(p))
+}
+
+type priorityHandler struct {
+	Handler
+	priority Priority
+}
+
+// WithPriority classes h as p, which is also shown in the route table.
+func WithPriority(h Handler, p Priority) Handler {
+	return &priorityHandler{Handler: h, priority: p}
+}
+
+func (ph *priorityHandler) Unwrap() Handler {
+	return ph.Handler
+}
+
+func (ph *priorityHandler) Describe() Route {
+	r := describeHandler(ph.Handler)
+	r.Priority = ph.priority
+	return r
+}
+
+// Adaptive makes the limit of [ConcurrencyLimit] follow the observed latency by AIMD,
+// which decreases it multiplicatively on congestion and increases it by one per limit of fine requests.
+type Adaptive struct {
+	MinLimit int
+	// Latency is the threshold over which a request indicates congestion, as does a response of 503 or 504.
+	Latency time.Duration
+	// Backoff is the ratio the limit is multiplied by on congestion, zero as 0.9.
+	Backoff float64
+}
+
+// ConcurrencyLimit configures [ConcurrencyLimiter].
+type ConcurrencyLimit struct {
+	// Limit is the max requests in flight, which is also the upper bound in the Adaptive mode.
+	Limit int
+	// Queue is the max requests waiting for a slot, zero as none waits.
+	Queue int
+	// QueueTimeout is the max wait, zero as the global timeout from [SetTimeout].
+	QueueTimeout time.Duration
+	// RetryAfter is told to rejected clients, zero as a second.
+	RetryAfter time.Duration
+	Adaptive   *Adaptive // nil as a fixed limit
+}
+
+type concurrencyLimiter struct {
+	config   ConcurrencyLimit
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	waiters  []chan struct{}
+}
+
+// ConcurrencyLimiter bounds requests in flight as cl, where excess ones wait in a bounded queue,
+// or are shed early with 503 and Retry-After rather than all running into their timeouts.
+// Use it by [Web.Use] for a global limit, or by [WithMiddlewares] for a limit of one handler.
+// A [Handler] of [PriorityCritical] bypasses it, and one of [PriorityLow] never waits.
+func ConcurrencyLimiter(cl ConcurrencyLimit) Middleware {
+	if cl.Limit <= 0 {
+		panic("concurrency limit requires a positive limit")
+	}
+	l := &concurrencyLimiter{config: cl, limit: float64(cl.Limit)}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			request, byBatch := admittedByBatch(request, l)
+			route, _ := DetachRoute(request.Context())
+			if byBatch || route.Priority >= PriorityCritical {
+				next.ServeHTTP(writer, request)
+				return
+			}
+			if !l.acquire(request.Context(), route.Priority > PriorityLow) {
+				writer.Header().Set("Retry-After", strconv.Itoa(max(ceilSeconds(cl.RetryAfter), 1)))
+				Logger(request.Context()).Warn("load shed", "method", request.Method, "url", request.URL)
+				writeProblem(writer, request, http.StatusServiceUnavailable, "server overloaded")
+				return
+			}
+			start := time.Now()
+			defer func() {
+				congested := cl.Adaptive != nil && cl.Adaptive.Latency > 0 && time.Since(start) > cl.Adaptive.Latency
+				if rw, ok := recordingWriter(writer); ok {
+					congested = congested || rw.status == http.StatusServiceUnavailable || rw.status == http.StatusGatewayTimeout
+				}
+				l.release(congested)
+			}()
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// acquire takes a slot, waiting in the queue if queued, false once rejected.
+func (l *concurrencyLimiter) acquire(ctx context.Context, queued bool) bool {
+	l.mu.Lock()
+	if l.inFlight < int(l.limit) && len(l.waiters) == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return true
+	}
+	if !queued || len(l.waiters) >= l.config.Queue {
+		l.mu.Unlock()
+		return false
+	}
+	ch := make(chan struct{})
+	l.waiters = append(l.waiters, ch)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(cmp.Or(l.config.QueueTimeout, timeout))
+	defer timer.Stop()
+	select {
+	case <-ch:
+		return true
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if i := slices.Index(l.waiters, ch); i >= 0 {
+		l.waiters = slices.Delete(l.waiters, i, i+1)
+		return false
+	}
+	// The slot is granted just after giving up, pass it on.
+	l.inFlight--
+	l.dispatch()
+	return false
+}
+
+func (l *concurrencyLimiter) release(congested bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if a := l.config.Adaptive; a != nil {
+		if congested {
+			l.limit *= cmp.Or(a.Backoff, 0.9)
+		} else {
+			l.limit += 1 / l.limit
+		}
+		l.limit = min(max(l.limit, float64(max(a.MinLimit, 1))), float64(l.config.Limit))
+	}
+	l.inFlight--
+	l.dispatch()
+}
+
+// dispatch grants slots to waiters in order, which must be called with mu locked.
+func (l *concurrencyLimiter) dispatch() {
+	for len(l.waiters) > 0 && l.inFlight < int(l.limit) {
+		l.inFlight++
+		close(l.waiters[0])
+		l.waiters = l.waiters[1:]
+	}
+}
@@ -0,0 +1,124 @@
+package wf
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	started, release := make(chan struct{}), make(chan struct{})
+	ok := func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		return []byte("ok"), nil
+	}
+	web := NewWeb(false,
+		NewEchoHandler("/block", 0, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+			close(started)
+			<-release
+			return []byte("ok"), nil
+		}),
+		WithPriority(NewEchoHandler("/health", 0, ok), PriorityCritical),
+		WithPriority(NewEchoHandler("/report", 0, ok), PriorityLow),
+		NewEchoHandler("/echo", 0, ok),
+	)
+	web.Use(ConcurrencyLimiter(ConcurrencyLimit{Limit: 1, Queue: 1, QueueTimeout: 10 * time.Millisecond, RetryAfter: 2 * time.Second}))
+
+	done := make(chan int)
+	go func() {
+		recorder := httptest.NewRecorder()
+		web.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/block", nil))
+		done <- recorder.Code
+	}()
+	<-started
+
+	tests := []struct {
+		target string
+		status int
+	}{
+		{"/echo", http.StatusServiceUnavailable},   // queued until timeout
+		{"/report", http.StatusServiceUnavailable}, // never queued
+		{"/health", http.StatusOK},
+	}
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		web.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if recorder.Code != tt.status {
+			t.Errorf("%s: want %d, got %d", tt.target, tt.status, recorder.Code)
+		}
+		if tt.status == http.StatusServiceUnavailable && recorder.Header().Get("Retry-After") != "2" {
+			t.Errorf("%s: want Retry-After, got %v", tt.target, recorder.Header())
+		}
+	}
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("want blocked one served, got %d", code)
+	}
+	recorder := httptest.NewRecorder()
+	web.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/echo", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("want served once released, got %d", recorder.Code)
+	}
+}
+
+func TestConcurrencyQueue(t *testing.T) {
+	l := &concurrencyLimiter{config: ConcurrencyLimit{Limit: 1, Queue: 1, QueueTimeout: time.Minute}, limit: 1}
+	ctx := context.Background()
+	if !l.acquire(ctx, true) {
+		t.Fatal("want the first admitted")
+	}
+	granted := make(chan bool)
+	go func() {
+		granted <- l.acquire(ctx, true)
+	}()
+	for queued := false; !queued; {
+		l.mu.Lock()
+		queued = len(l.waiters) == 1
+		l.mu.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+	if l.acquire(ctx, true) {
+		t.Error("want rejected once the queue is full")
+	}
+	l.release(false)
+	if !<-granted {
+		t.Error("want the queued one granted on release")
+	}
+	if l.inFlight != 1 {
+		t.Errorf("want one in flight, got %d", l.inFlight)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if l.acquire(canceled, true) {
+		t.Error("want rejected on canceled context")
+	}
+	if len(l.waiters) != 0 {
+		t.Errorf("want waiter removed, got %d", len(l.waiters))
+	}
+}
+
+func TestConcurrencyAdaptive(t *testing.T) {
+	l := &concurrencyLimiter{config: ConcurrencyLimit{Limit: 10, Adaptive: &Adaptive{MinLimit: 2, Backoff: 0.5}}, limit: 10}
+	l.inFlight = 3
+	l.release(true)
+	l.release(true)
+	if l.limit != 2.5 {
+		t.Errorf("want decreased to 2.5, got %v", l.limit)
+	}
+	l.release(true)
+	if l.limit != 2 {
+		t.Errorf("want bounded by min 2, got %v", l.limit)
+	}
+	for range 10 {
+		l.inFlight++
+		l.release(false)
+	}
+	if l.limit <= 4 || l.limit >= 5 {
+		t.Errorf("want increased additively, got %v", l.limit)
+	}
+}
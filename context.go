@@ -0,0 +1,29 @@
+package wf
+
+import "context"
+
+// ContextValue is a request-scoped value of type T, such as a tenant or a locale attached by a [Middleware].
+// Its key is the ContextValue itself, which never collides with another one, even of the same name and type.
+type ContextValue[T any] struct {
+	name string
+}
+
+// NewContextValue creates a ContextValue, whose name is only for debugging.
+// Declare it as a package level variable, and share it between who attaches and who detaches.
+func NewContextValue[T any](name string) *ContextValue[T] {
+	return &ContextValue[T]{name: name}
+}
+
+func (cv *ContextValue[T]) Attach(ctx context.Context, value T) context.Context {
+	return context.WithValue(ctx, cv, value)
+}
+
+// Detach returns the value attached to ctx, false if none.
+func (cv *ContextValue[T]) Detach(ctx context.Context) (T, bool) {
+	value, ok := ctx.Value(cv).(T)
+	return value, ok
+}
+
+func (cv *ContextValue[T]) String() string {
+	return "wf.ContextValue(" + cv.name + ")"
+}
@@ -0,0 +1,41 @@
+package wf
+
+import (
+	"context"
+	"testing"
+)
+
+func TestContextValue(t *testing.T) {
+	tenant := NewContextValue[string]("tenant")
+	locale := NewContextValue[string]("tenant")
+
+	ctx := context.Background()
+	if _, ok := tenant.Detach(ctx); ok {
+		t.Errorf("want none from empty context")
+	}
+	ctx = tenant.Attach(ctx, "acme")
+	if v, ok := tenant.Detach(ctx); !ok || v != "acme" {
+		t.Errorf("want acme, got %q %v", v, ok)
+	}
+	if v, ok := locale.Detach(ctx); ok {
+		t.Errorf("want no collision of the same name, got %q", v)
+	}
+	if got := tenant.String(); got != "wf.ContextValue(tenant)" {
+		t.Errorf("unexpected string %q", got)
+	}
+}
+
+func TestDetachToken(t *testing.T) {
+	if token, ok := DetachToken(context.Background()); ok || token != "" {
+		t.Errorf("want none, got %q %v", token, ok)
+	}
+	// A plain string key of the same name, which is what other packages may use, never collides.
+	//lint:ignore SA1029 it's the colliding usage on purpose
+	ctx := context.WithValue(context.Background(), "token", "foreign")
+	if token, ok := DetachToken(ctx); ok {
+		t.Errorf("want no collision, got %q", token)
+	}
+	if token, ok := DetachToken(AttachToken(ctx, "mine")); !ok || token != "mine" {
+		t.Errorf("want mine, got %q %v", token, ok)
+	}
+}
@@ -17,19 +17,37 @@ func main() {
 		Exact(http.MethodPost, "/v1/vital"),
 		ParseEmpty,
 		func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
-			token := DetachToken(ctx)
-			if token == "" {
+			token, ok := DetachToken(ctx)
+			if !ok {
 				return nil, NewCodedError(http.StatusUnauthorized, errors.New("need token"))
 			}
 			if !valid(token) {
-				return nil, NewCodedErrorf(http.StatusForbidden, "invalid token %s", token)
+				return nil, NewCodedErrorf(http.StatusForbidden, "invalid token")
 			}
 			return nil, nil
 		},
 		FormatEmpty,
 		"text/plain",
 	)
-	web := NewWeb(false, handler)
+	// The same check, but done by the framework before Parse, with the resolved Principal in ctx.
+	authenticated := WithAuthenticator(NewClosureHandler(
+		Exact(http.MethodPost, "/v2/vital"),
+		ParseEmpty,
+		func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+			p, _ := DetachPrincipal(ctx)
+			return "hello " + p.Subject, nil
+		},
+		func(output any) (data []byte, err error) {
+			return []byte(output.(string)), nil
+		},
+		"text/plain",
+	), TokenAuth(func(_ context.Context, token string) (*Principal, error) {
+		if !valid(token) {
+			return nil, errors.New("invalid token")
+		}
+		return &Principal{Subject: "admin"}, nil
+	}))
+	web := NewWeb(false, handler, authenticated)
 	if err := http.ListenAndServe("localhost:8080", web); err != nil {
 		log.Fatal(err)
 	}
@@ -30,7 +30,10 @@ func main() {
 	)
 	handler.Timeout = timeoutSeconds * time.Second // override global timeout
 	web := wf.NewWeb(false, handler)
-	if err := http.ListenAndServe("localhost:8080", web); err != nil {
+	server := wf.NewServer("localhost:8080", web)
+	// Subscribers are told before their streams are closed on Ctrl-C.
+	server.FinalEvent = &wf.MessageEvent{TypeOptional: "shutdown", Lines: []string{"server is going away"}}
+	if err := server.ListenAndServe(context.Background()); err != nil {
 		log.Fatal(err)
 	}
 }
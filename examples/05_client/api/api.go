@@ -0,0 +1,51 @@
+// Package api is what a service exposes, and what cmd/wfclient reads to generate the typed client.
+package api
+
+//go:generate go run github.com/hyisen/wf/cmd/wfclient
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"github.com/hyisen/wf"
+)
+
+type GreetRequest struct {
+	Name string `json:"name"`
+}
+
+type GreetResponse struct {
+	Message string `json:"message"`
+}
+
+type Stats struct {
+	Greeted int64 `json:"greeted"`
+}
+
+var greeted atomic.Int64
+
+func Handlers() []wf.Handler {
+	stats := wf.NewJSONHandler(
+		wf.Exact(http.MethodGet, "/v1/stats"),
+		reflect.TypeOf(wf.Empty{}),
+		func(ctx context.Context, req any) (rsp any, codedError *wf.CodedError) {
+			return Stats{Greeted: greeted.Load()}, nil
+		},
+	)
+	return []wf.Handler{
+		wf.NewJSONHandler(wf.Exact(http.MethodPost, "/v1/greet"), reflect.TypeOf(GreetRequest{}), Greet),
+		stats,
+	}
+}
+
+func Greet(_ context.Context, req any) (rsp any, codedError *wf.CodedError) {
+	r := req.(*GreetRequest)
+	if strings.TrimSpace(r.Name) == "" {
+		return nil, wf.NewCodedErrorf(http.StatusBadRequest, "empty name")
+	}
+	greeted.Add(1)
+	return &GreetResponse{Message: "Hello, " + r.Name + "!"}, nil
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hyisen/wf"
+)
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(wf.NewWeb(false, Handlers()...))
+	defer server.Close()
+	client := NewClient(server.URL, server.Client())
+	ctx := context.Background()
+
+	before, err := client.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsp, err := client.Greet(ctx, &GreetRequest{Name: "Alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Hello, Alice!"; rsp.Message != want {
+		t.Errorf("want message %q, got %q", want, rsp.Message)
+	}
+
+	after, err := client.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Greeted != before.Greeted+1 {
+		t.Errorf("want greeted %d, got %d", before.Greeted+1, after.Greeted)
+	}
+}
+
+func TestClientCodedError(t *testing.T) {
+	server := httptest.NewServer(wf.NewWeb(false, Handlers()...))
+	defer server.Close()
+	client := NewClient(server.URL, server.Client())
+
+	_, err := client.Greet(context.Background(), &GreetRequest{Name: " "})
+	var ce *wf.CodedError
+	if !errors.As(err, &ce) {
+		t.Fatalf("want CodedError, got %v", err)
+	}
+	if ce.Code != http.StatusBadRequest {
+		t.Errorf("want code %d, got %d", http.StatusBadRequest, ce.Code)
+	}
+	if want := "empty name"; ce.Err.Error() != want {
+		t.Errorf("want err %q, got %q", want, ce.Err.Error())
+	}
+}
@@ -0,0 +1,38 @@
+// Code generated by wfclient; DO NOT EDIT.
+
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/hyisen/wf"
+)
+
+// Client is a typed client of the handlers registered in package api.
+// Any non-2XX response is returned as a *wf.CodedError.
+type Client struct {
+	*wf.Client
+}
+
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	return &Client{Client: wf.NewClient(baseURL, httpClient)}
+}
+
+// Stats calls GET /v1/stats.
+func (c *Client) Stats(ctx context.Context) (*Stats, error) {
+	var rsp Stats
+	if err := c.Call(ctx, http.MethodGet, "/v1/stats", nil, &rsp); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
+// Greet calls POST /v1/greet.
+func (c *Client) Greet(ctx context.Context, req *GreetRequest) (*GreetResponse, error) {
+	var rsp GreetResponse
+	if err := c.Call(ctx, http.MethodPost, "/v1/greet", req, &rsp); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"github.com/hyisen/wf"
+	"github.com/hyisen/wf/examples/05_client/api"
+	"log"
+	"net/http"
+)
+
+func main() {
+	web := wf.NewWeb(false, api.Handlers()...)
+	if err := http.ListenAndServe("localhost:8080", web); err != nil {
+		log.Fatal(err)
+	}
+}
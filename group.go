@@ -0,0 +1,152 @@
+package wf
+
+import (
+	"cmp"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Group builds handlers that share a path prefix, middlewares and a default timeout,
+// and then compiles into the flat handlers that [NewWeb] takes, through [Group.Handlers].
+//
+//	v1 := NewGroup("/v1")
+//	v1.Group("/admin").Use(auth).DefaultTimeout(5 * time.Second).Handle(users, roles)
+//	v1.Group("/public").Use(cors).Handle(info)
+//	web := NewWeb(false, v1.Handlers()...)
+//
+// Matchers and parsers of handlers in a group see the path with the prefix trimmed,
+// e.g., users above is matched by Exact(http.MethodGet, "/users") on /v1/admin/users.
+type Group struct {
+	prefix      string
+	middlewares []Middleware
+	timeout     time.Duration
+	items       []groupItem
+}
+
+// groupItem is either a handler or a child group, to keep the order of registration.
+type groupItem struct {
+	handler Handler
+	group   *Group
+}
+
+// NewGroup creates a Group under prefix, which could be empty to share only middlewares and timeout.
+func NewGroup(prefix string) *Group {
+	return &Group{prefix: strings.TrimSuffix(prefix, "/")}
+}
+
+// Group creates a child group under prefix, registered in place, which inherits what its parent has.
+func (g *Group) Group(prefix string) *Group {
+	child := NewGroup(prefix)
+	g.items = append(g.items, groupItem{group: child})
+	return child
+}
+
+// Use adds middlewares to every handler in the group, outside the ones of child groups and handlers.
+func (g *Group) Use(middlewares ...Middleware) *Group {
+	g.middlewares = append(g.middlewares, middlewares...)
+	return g
+}
+
+// DefaultTimeout sets the timeout of handlers in the group without a stand-alone [TimeoutConfig],
+// which is overridden by the one of a child group.
+func (g *Group) DefaultTimeout(timeout time.Duration) *Group {
+	g.timeout = timeout
+	return g
+}
+
+func (g *Group) Handle(handlers ...Handler) *Group {
+	for _, h := range handlers {
+		g.items = append(g.items, groupItem{handler: h})
+	}
+	return g
+}
+
+// Handlers compiles the group into handlers in the order of registration.
+func (g *Group) Handlers() []Handler {
+	var ret []Handler
+	for _, item := range g.items {
+		if item.group != nil {
+			for _, h := range item.group.Handlers() {
+				ret = append(ret, g.wrap(h))
+			}
+		} else {
+			ret = append(ret, g.wrap(item.handler))
+		}
+	}
+	return ret
+}
+
+func (g *Group) wrap(h Handler) Handler {
+	return &groupHandler{
+		Handler:     h,
+		prefix:      g.prefix,
+		middlewares: g.middlewares,
+		timeout:     g.timeout,
+	}
+}
+
+type groupHandler struct {
+	Handler
+	prefix      string
+	middlewares []Middleware
+	timeout     time.Duration
+}
+
+// cutPathPrefix is like [strings.CutPrefix] but only on a whole segment,
+// which means /v1 is the prefix of /v1 and /v1/a, but not /v1a.
+func cutPathPrefix(path string, prefix string) (string, bool) {
+	rest, found := strings.CutPrefix(path, prefix)
+	if !found || (rest != "" && rest[0] != '/') {
+		return path, false
+	}
+	return cmp.Or(rest, "/"), true
+}
+
+func (gh *groupHandler) Match(req *http.Request) bool {
+	if _, found := cutPathPrefix(req.URL.Path, gh.prefix); !found {
+		return false
+	}
+	return gh.Handler.Match(gh.rewritePath(req))
+}
+
+func (gh *groupHandler) rewritePath(req *http.Request) *http.Request {
+	rest, _ := cutPathPrefix(req.URL.Path, gh.prefix)
+	return withPath(req, rest)
+}
+
+func (gh *groupHandler) Parse(data []byte, path string) (any, error) {
+	rest, _ := cutPathPrefix(path, gh.prefix)
+	return gh.Handler.Parse(data, rest)
+}
+
+func (gh *groupHandler) TimeoutOptional() time.Duration {
+	return cmp.Or(gh.Handler.TimeoutOptional(), gh.timeout)
+}
+
+func (gh *groupHandler) Middlewares() []Middleware {
+	return gh.middlewares
+}
+
+func (gh *groupHandler) Unwrap() Handler {
+	return gh.Handler
+}
+
+func (gh *groupHandler) Describe() Route {
+	r := describeHandler(gh.Handler)
+	if r.Pattern.Path != "" {
+		r.Pattern.Path = gh.prefix + r.Pattern.Path
+	}
+	r.Timeout = gh.TimeoutOptional()
+	return r
+}
+
+// withPath returns a shallow copy of req whose URL.Path is replaced by path.
+func withPath(req *http.Request, path string) *http.Request {
+	u := *req.URL
+	u.Path = path
+	u.RawPath = ""
+	r := *req
+	r.URL = &u
+	return &r
+}
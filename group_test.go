@@ -0,0 +1,88 @@
+package wf
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newPathHandler(matcher CanMatch) *ClosureHandler {
+	return NewClosureHandler(
+		matcher,
+		func(_ []byte, path string) (any, error) {
+			return path, nil
+		},
+		func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+			deadline, _ := ctx.Deadline()
+			return req.(string) + " " + time.Until(deadline).Round(time.Second).String(), nil
+		},
+		func(output any) (data []byte, err error) {
+			return []byte(output.(string)), nil
+		},
+		"text/plain",
+	)
+}
+
+func tagging(tag string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Add("X-Tag", tag)
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
+
+func TestGroup(t *testing.T) {
+	v1 := NewGroup("/v1/").Use(tagging("v1")).DefaultTimeout(2 * time.Second)
+	v1.Group("/admin").Use(tagging("admin")).DefaultTimeout(3 * time.Second).Handle(
+		newPathHandler(ResourceWithID(http.MethodGet, "/users/", "")),
+	)
+	own := newPathHandler(Exact(http.MethodGet, "/info"))
+	own.Timeout = 4 * time.Second
+	v1.Group("/public").Handle(own, WithMiddlewares(newPathHandler(Exact(http.MethodGet, "/")), tagging("root")))
+	web := NewWeb(false, v1.Handlers()...)
+	web.Use(tagging("web"))
+
+	tests := []struct {
+		target string
+		status int
+		body   string
+		tags   string
+	}{
+		{"/v1/admin/users/12", http.StatusOK, "/users/12 3s", "web,v1,admin"},
+		{"/v1/public/info", http.StatusOK, "/info 4s", "web,v1"},
+		{"/v1/public", http.StatusOK, "/ 2s", "web,v1,root"},
+		{"/v1/publicity", http.StatusNotAcceptable, "", ""},
+		{"/v1/admin/users/12/more", http.StatusNotAcceptable, "", ""},
+		{"/admin/users/12", http.StatusNotAcceptable, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			web.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if recorder.Code != tt.status {
+				t.Fatalf("want status %d, got %d", tt.status, recorder.Code)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if recorder.Body.String() != tt.body {
+				t.Errorf("want body %q, got %q", tt.body, recorder.Body.String())
+			}
+			if tags := strings.Join(recorder.Header().Values("X-Tag"), ","); tags != tt.tags {
+				t.Errorf("want tags %q, got %q", tt.tags, tags)
+			}
+		})
+	}
+
+	var paths []string
+	for _, r := range web.Routes() {
+		paths = append(paths, r.Pattern.Path+" "+r.Timeout.String())
+	}
+	if got, want := strings.Join(paths, ","), "/v1/admin/users/{id} 3s,/v1/public/info 4s,/v1/public/ 2s"; got != want {
+		t.Errorf("want routes %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,186 @@
+package wf
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Criticality tells whether a failed [HealthCheck] fails the whole report.
+type Criticality int
+
+const (
+	// Critical fails the report, which responds 503.
+	Critical Criticality = iota
+	// NonCritical only degrades the report, which still responds 200.
+	NonCritical
+)
+
+// HealthCheck is a named probe of a dependency, such as pinging a database.
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+	// Timeout bounds a run of Check, zero as the global one from [SetTimeout].
+	Timeout time.Duration
+	// CacheFor reuses the last result within it, so that frequent probes don't overload the dependency.
+	CacheFor    time.Duration
+	Criticality Criticality
+}
+
+const (
+	HealthUp       = "up"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+)
+
+// HealthReport is what a [HealthHandler] responds.
+type HealthReport struct {
+	Status string              `json:"status"`
+	Checks []HealthCheckResult `json:"checks,omitempty"`
+}
+
+type HealthCheckResult struct {
+	Name     string        `json:"name"`
+	Status   string        `json:"status"`
+	Critical bool          `json:"critical"`
+	Latency  time.Duration `json:"-"`
+	Error    string        `json:"error,omitempty"`
+	Cached   bool          `json:"cached,omitempty"`
+}
+
+func (r HealthCheckResult) MarshalJSON() ([]byte, error) {
+	type result HealthCheckResult
+	return json.Marshal(struct {
+		result
+		Latency string `json:"latency"`
+	}{result(r), r.Latency.String()})
+}
+
+type healthCheck struct {
+	HealthCheck
+	mu     sync.Mutex
+	last   HealthCheckResult
+	expiry time.Time
+}
+
+func (hc *healthCheck) run(ctx context.Context) HealthCheckResult {
+	now := Now(ctx)
+	hc.mu.Lock()
+	if now.Before(hc.expiry) {
+		r := hc.last
+		hc.mu.Unlock()
+		r.Cached = true
+		return r
+	}
+	hc.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, cmp.Or(hc.Timeout, timeout))
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- fmt.Errorf("panic: %v", p)
+			}
+		}()
+		done <- hc.Check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// Not waiting for a Check that ignores ctx.
+		err = fmt.Errorf("timeout after %v", cmp.Or(hc.Timeout, timeout))
+	}
+	r := HealthCheckResult{Name: hc.Name, Status: HealthUp, Critical: hc.Criticality == Critical, Latency: time.Since(start)}
+	if err != nil {
+		r.Status, r.Error = HealthDown, err.Error()
+	}
+	hc.mu.Lock()
+	hc.last, hc.expiry = r, now.Add(hc.CacheFor)
+	hc.mu.Unlock()
+	return r
+}
+
+// HealthHandler responds a JSON [HealthReport] of its checks, run concurrently,
+// with 200 if every critical one is up, or 503 otherwise.
+type HealthHandler struct {
+	*MountedHandler
+	checks    []*healthCheck
+	readiness bool
+	web       *Web
+}
+
+// NewLivenessHandler reports whether the process works at all, which should only check what a restart fixes.
+func NewLivenessHandler(matcher CanMatch, checks ...HealthCheck) *HealthHandler {
+	return newHealthHandler(matcher, false, checks)
+}
+
+// ReadinessHandler is the [HealthHandler] made by [NewReadinessHandler].
+type ReadinessHandler = HealthHandler
+
+// NewReadinessHandler reports whether the [Web] it's registered in could take traffic,
+// which is down once a [Server] starts draining it, or if it's served without being registered.
+func NewReadinessHandler(matcher CanMatch, checks ...HealthCheck) *ReadinessHandler {
+	return newHealthHandler(matcher, true, checks)
+}
+
+func newHealthHandler(matcher CanMatch, readiness bool, checks []HealthCheck) *HealthHandler {
+	hh := &HealthHandler{readiness: readiness}
+	for _, c := range checks {
+		hh.checks = append(hh.checks, &healthCheck{HealthCheck: c})
+	}
+	hh.MountedHandler = Mount(matcher, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		report := hh.Report(request.Context())
+		data, err := json.Marshal(report)
+		if err != nil {
+			Logger(request.Context()).Error("unexpected failure on marshal", "err", err)
+			writer.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", JSONContentType)
+		writer.Header().Set("Cache-Control", "no-store")
+		if report.Status == HealthDown {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_, _ = writer.Write(data)
+	}))
+	return hh
+}
+
+func (hh *HealthHandler) bindWeb(w *Web) {
+	hh.web = w
+}
+
+// Report runs every check, or reuses their cached results.
+func (hh *HealthHandler) Report(ctx context.Context) HealthReport {
+	report := HealthReport{Status: HealthUp, Checks: make([]HealthCheckResult, len(hh.checks))}
+	var wg sync.WaitGroup
+	for i, hc := range hh.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = hc.run(ctx)
+		}()
+	}
+	wg.Wait()
+	// Failing closed if not registered in a Web, which is a probe wired wrong.
+	if hh.readiness && (hh.web == nil || !hh.web.Ready()) {
+		report.Checks = append(report.Checks, HealthCheckResult{Name: "draining", Status: HealthDown, Critical: true})
+	}
+	for _, r := range report.Checks {
+		switch {
+		case r.Status == HealthUp:
+		case r.Critical:
+			report.Status = HealthDown
+		case report.Status == HealthUp:
+			report.Status = HealthDegraded
+		}
+	}
+	return report
+}
@@ -0,0 +1,93 @@
+package wf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthHandler(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	var cacheErr error
+	web := NewWeb(false,
+		NewLivenessHandler(Exact(http.MethodGet, "/healthz")),
+		NewReadinessHandler(Exact(http.MethodGet, "/readyz"),
+			HealthCheck{Name: "db", Check: func(ctx context.Context) error { return nil }},
+			HealthCheck{Name: "cache", Criticality: NonCritical, Check: func(ctx context.Context) error { return cacheErr }},
+			HealthCheck{Name: "slow", Timeout: 10 * time.Millisecond, Criticality: NonCritical, Check: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}},
+		),
+	)
+	get := func(target string) (int, HealthReport) {
+		recorder := httptest.NewRecorder()
+		web.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		var report HealthReport
+		if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+			t.Fatalf("%s: unexpected body %q", target, recorder.Body)
+		}
+		return recorder.Code, report
+	}
+
+	if code, report := get("/healthz"); code != http.StatusOK || report.Status != HealthUp {
+		t.Errorf("want live, got %d %+v", code, report)
+	}
+	code, report := get("/readyz")
+	if code != http.StatusOK || report.Status != HealthDegraded {
+		t.Errorf("want degraded by the timed out slow, got %d %+v", code, report)
+	}
+	if len(report.Checks) != 3 || report.Checks[0].Name != "db" || report.Checks[2].Status != HealthDown {
+		t.Errorf("unexpected checks %+v", report.Checks)
+	}
+
+	web.drain(nil)
+	code, report = get("/readyz")
+	if code != http.StatusServiceUnavailable || report.Status != HealthDown {
+		t.Errorf("want down while draining, got %d %+v", code, report)
+	}
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Errorf("want still live while draining, got %d", code)
+	}
+}
+
+func TestHealthCheckCache(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	ctx := AttachClock(context.Background(), func() time.Time { return now })
+	runs := 0
+	hh := NewLivenessHandler(Exact(http.MethodGet, "/healthz"), HealthCheck{
+		Name:     "db",
+		CacheFor: time.Minute,
+		Check: func(ctx context.Context) error {
+			runs++
+			return errors.New("refused")
+		},
+	})
+
+	report := hh.Report(ctx)
+	if report.Status != HealthDown || report.Checks[0].Error != "refused" || report.Checks[0].Cached {
+		t.Errorf("want down by critical db, got %+v", report)
+	}
+	if report = hh.Report(ctx); !report.Checks[0].Cached || runs != 1 {
+		t.Errorf("want cached, got %+v after %d runs", report, runs)
+	}
+	now = now.Add(time.Minute)
+	if report = hh.Report(ctx); report.Checks[0].Cached || runs != 2 {
+		t.Errorf("want run again once expired, got %+v after %d runs", report, runs)
+	}
+}
+
+func TestReadinessHandlerUnbound(t *testing.T) {
+	rh := NewReadinessHandler(Exact(http.MethodGet, "/readyz"))
+	recorder := httptest.NewRecorder()
+	rh.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("want 503 if not registered in a Web, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,190 @@
+package wf
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyRecord is what an [IdempotencyStore] keeps per key, which is plain data for a shared backend to persist.
+type IdempotencyRecord struct {
+	BodyHash string // of the method, path, query and body of the request, hex of SHA-256
+	Status   int    // zero as still in flight
+	Header   http.Header
+	Body     []byte
+}
+
+// IdempotencyStore keeps [IdempotencyRecord] by key, see [NewMemoryIdempotencyStore].
+// A shared backend, such as Redis, makes retries to another instance replayed too.
+type IdempotencyStore interface {
+	// Lock records key in flight with hash for ttl and returns true if key is absent,
+	// or returns the existing record of key otherwise, atomically.
+	Lock(ctx context.Context, key, hash string, ttl time.Duration) (record IdempotencyRecord, locked bool, err error)
+	// Save replaces the record of key with a completed one, kept for ttl.
+	Save(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) error
+	// Delete forgets key, so that a retry runs again.
+	Delete(ctx context.Context, key string) error
+}
+
+// Idempotency configures [Idempotent].
+type Idempotency struct {
+	// TTL is how long a completed response is replayed, zero as 24 hours.
+	TTL time.Duration
+	// LockTTL bounds how long a request stays in flight, in case its instance dies, zero as a minute.
+	LockTTL time.Duration
+	Store   IdempotencyStore // nil as a new in-memory one
+}
+
+// Idempotent makes requests of unsafe methods with the Idempotency-Key header run at most once
+// per key, principal and route, so that retries by clients and proxies cause no duplicate side effects.
+//
+// The first completed response is stored and replayed to retries with Idempotent-Replayed: true.
+// A retry while the first is in flight is rejected with 409, and one with a different method, path, query
+// or body with 422, such as reusing a key on another resource of the same route.
+// A response of 5xx is not stored, so that it could be retried.
+// Failures of Store are logged and the request runs as if without the key.
+func Idempotent(config Idempotency) Middleware {
+	ttl := cmp.Or(config.TTL, 24*time.Hour)
+	lockTTL := cmp.Or(config.LockTTL, time.Minute)
+	if config.Store == nil {
+		config.Store = NewMemoryIdempotencyStore()
+	}
+	scope := KeyBy(KeyByPrincipal(), KeyByRoute())
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			idempotencyKey := request.Header.Get(IdempotencyKeyHeader)
+			if idempotencyKey == "" || isSafeMethod(request.Method) {
+				next.ServeHTTP(writer, request)
+				return
+			}
+			ctx := request.Context()
+			logger := Logger(ctx)
+			body, err := io.ReadAll(request.Body)
+			if err != nil {
+				logger.Warn("can not read body", "err", err)
+				writeProblem(writer, request, http.StatusBadRequest, "can not read body")
+				return
+			}
+			request.Body = io.NopCloser(bytes.NewReader(body))
+			hash := fingerprint(request, body)
+
+			key := scope(request) + "|" + idempotencyKey
+			record, locked, err := config.Store.Lock(ctx, key, hash, lockTTL)
+			if err != nil {
+				logger.Error("unexpected failure on idempotency lock", "err", err)
+				next.ServeHTTP(writer, request)
+				return
+			}
+			if !locked {
+				switch {
+				case record.BodyHash != hash:
+					writeProblem(writer, request, http.StatusUnprocessableEntity, "Idempotency-Key reused with a different request")
+				case record.Status == 0:
+					writeProblem(writer, request, http.StatusConflict, "request with the same Idempotency-Key in flight")
+				default:
+					logger.Debug("replay idempotent response", "status", record.Status)
+					writer.Header().Set("Idempotent-Replayed", "true")
+					replay(writer, record.Status, record.Header, record.Body)
+				}
+				return
+			}
+
+			cw := capture(writer)
+			saved := false
+			defer func() {
+				// Also on panic, which is recovered by Web outside.
+				if !saved {
+					if err := config.Store.Delete(context.WithoutCancel(ctx), key); err != nil {
+						logger.Error("unexpected failure on idempotency delete", "err", err)
+					}
+				}
+			}()
+			next.ServeHTTP(cw, request)
+			status, header := cw.captured()
+			if status >= http.StatusInternalServerError {
+				return
+			}
+			record = IdempotencyRecord{BodyHash: hash, Status: status, Header: replayable(header), Body: cw.body.Bytes()}
+			if err := config.Store.Save(context.WithoutCancel(ctx), key, record, ttl); err != nil {
+				logger.Error("unexpected failure on idempotency save", "err", err)
+				return
+			}
+			saved = true
+		})
+	}
+}
+
+// fingerprint tells requests apart by what a retry must repeat, which is hex of SHA-256.
+func fingerprint(request *http.Request, body []byte) string {
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s %s?%s\n", request.Method, request.URL.Path, request.URL.Query().Encode())
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// MemoryIdempotencyStore is an [IdempotencyStore] in memory, which only replays within one instance.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryIdempotencyEntry
+	updates int
+}
+
+type memoryIdempotencyEntry struct {
+	record  IdempotencyRecord
+	expires time.Time
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{entries: map[string]*memoryIdempotencyEntry{}}
+}
+
+func (s *MemoryIdempotencyStore) Lock(ctx context.Context, key, hash string, ttl time.Duration) (IdempotencyRecord, bool, error) {
+	now := Now(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updates++
+	if s.updates%sweepEvery == 0 {
+		for k, e := range s.entries {
+			if now.After(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+	}
+	if e, ok := s.entries[key]; ok && !now.After(e.expires) {
+		return e.record, false, nil
+	}
+	s.entries[key] = &memoryIdempotencyEntry{record: IdempotencyRecord{BodyHash: hash}, expires: now.Add(ttl)}
+	return IdempotencyRecord{}, true, nil
+}
+
+func (s *MemoryIdempotencyStore) Save(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) error {
+	now := Now(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = &memoryIdempotencyEntry{record: record, expires: now.Add(ttl)}
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
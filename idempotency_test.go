@@ -0,0 +1,166 @@
+package wf
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotent(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	charges, blocked := 0, make(chan struct{})
+	started, release := make(chan struct{}), make(chan struct{})
+	h := NewClosureHandler(Exact(http.MethodPost, "/pay"),
+		func(data []byte, _ string) (any, error) {
+			return string(data), nil
+		},
+		func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+			if req == "block" {
+				close(started)
+				<-release
+			}
+			if req == "fail" {
+				return nil, NewCodedErrorf(http.StatusBadGateway, "upstream")
+			}
+			charges++
+			return []byte("charge " + strconv.Itoa(charges)), nil
+		},
+		func(output any) ([]byte, error) {
+			return output.([]byte), nil
+		},
+		"text/plain")
+	web := NewWeb(false, h)
+	web.Use(Idempotent(Idempotency{}))
+	pay := func(key, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/pay", strings.NewReader(body))
+		if key != "" {
+			request.Header.Set(IdempotencyKeyHeader, key)
+		}
+		web.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	first := pay("k1", "10")
+	retry := pay("k1", "10")
+	if first.Code != http.StatusOK || retry.Code != http.StatusOK || retry.Body.String() != "charge 1" || charges != 1 {
+		t.Errorf("want replayed, got %d %q then %d %q", first.Code, first.Body, retry.Code, retry.Body)
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" || retry.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("want replayed headers, got %v", retry.Header())
+	}
+	if r := pay("k1", "20"); r.Code != http.StatusUnprocessableEntity {
+		t.Errorf("want 422 on a different body, got %d", r.Code)
+	}
+	if r := pay("", "10"); r.Body.String() != "charge 2" {
+		t.Errorf("want run without key, got %q", r.Body)
+	}
+	if r := pay("fail", "fail"); r.Code != http.StatusBadGateway {
+		t.Errorf("want failed, got %d", r.Code)
+	}
+	if r := pay("fail", "10"); r.Code != http.StatusOK || r.Body.String() != "charge 3" {
+		t.Errorf("want a 5xx not stored, got %d %q", r.Code, r.Body)
+	}
+
+	go func() {
+		pay("k2", "block")
+		close(blocked)
+	}()
+	<-started
+	if r := pay("k2", "block"); r.Code != http.StatusConflict || r.Header().Get("Content-Type") != ProblemContentType {
+		t.Errorf("want 409 while in flight, got %d", r.Code)
+	}
+	close(release)
+	<-blocked
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	store := NewMemoryIdempotencyStore()
+	ctx := context.Background()
+	if _, locked, _ := store.Lock(ctx, "a", "h", time.Minute); !locked {
+		t.Error("want locked when absent")
+	}
+	if r, locked, _ := store.Lock(ctx, "a", "h2", time.Minute); locked || r.BodyHash != "h" {
+		t.Errorf("want the existing one, got %v %+v", locked, r)
+	}
+	_ = store.Delete(ctx, "a")
+	if _, locked, _ := store.Lock(ctx, "a", "h2", time.Minute); !locked {
+		t.Error("want locked once deleted")
+	}
+}
+
+func TestIdempotentReplaysOnlyResponseHeaders(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	web := NewWeb(true, WithMiddlewares(NewJSONHandler(Exact(http.MethodPost, "/pay"), reflect.TypeOf(0), func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		return "paid", nil
+	}), RateLimiter(RateLimit{Limit: 10, Window: time.Minute})))
+	web.Use(Idempotent(Idempotency{}))
+	pay := func(origin string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/pay", strings.NewReader("10"))
+		request.Header.Set(IdempotencyKeyHeader, "k1")
+		request.Header.Set("Origin", origin)
+		web.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if first := pay("https://a.example"); first.Header().Get("RateLimit-Remaining") != "9" {
+		t.Fatalf("want rate limited, got %v", first.Header())
+	}
+	retry := pay("https://b.example")
+	if retry.Body.String() != `"paid"` || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("want replayed, got %d %q", retry.Code, retry.Body)
+	}
+	if got := retry.Header().Get("Access-Control-Allow-Origin"); got != "https://b.example" {
+		t.Errorf("want CORS of the retry, got %q", got)
+	}
+	if got := retry.Header().Get("RateLimit-Remaining"); got != "" {
+		t.Errorf("want rate limit headers of the first request not replayed, got %q", got)
+	}
+}
+
+func TestIdempotentKeyReusedOnAnotherResource(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	runs := 0
+	web := NewWeb(false, NewClosureHandler(ResourceWithID(http.MethodPost, "/items/", ""),
+		func(_ []byte, path string) (any, error) {
+			return path, nil
+		},
+		func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+			runs++
+			return []byte(req.(string)), nil
+		},
+		func(output any) ([]byte, error) {
+			return output.([]byte), nil
+		},
+		"text/plain"))
+	web.Use(Idempotent(Idempotency{}))
+	post := func(target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, target, strings.NewReader("{}"))
+		request.Header.Set(IdempotencyKeyHeader, "k")
+		web.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if r := post("/items/1"); r.Code != http.StatusOK || r.Body.String() != "/items/1" {
+		t.Fatalf("want served, got %d %q", r.Code, r.Body)
+	}
+	for _, target := range []string{"/items/2", "/items/1?force=1"} {
+		if r := post(target); r.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: want 422 on a key reused for another request, got %d %q", target, r.Code, r.Body)
+		}
+	}
+	if runs != 1 {
+		t.Errorf("want run once, got %d", runs)
+	}
+}
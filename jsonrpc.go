@@ -0,0 +1,295 @@
+package wf
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Error codes of JSON-RPC 2.0, where -32000 to -32099 are for server errors.
+const (
+	JSONRPCParseError     = -32700
+	JSONRPCInvalidRequest = -32600
+	JSONRPCMethodNotFound = -32601
+	JSONRPCInvalidParams  = -32602
+	JSONRPCInternalError  = -32603
+	JSONRPCServerError    = -32000
+)
+
+// JSONRPCError is the error of a JSON-RPC response, whose Data has the HTTP status of a [CodedError].
+type JSONRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+type jsonrpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"` // absent as a notification
+}
+
+type jsonrpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"` // "null" rather than absent on success
+	Error   *JSONRPCError   `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// jsonrpcCall is what [JSONRPCHandler] parses, which holds a parse error to respond in JSON-RPC rather than 400.
+type jsonrpcCall struct {
+	batch    bool
+	requests []json.RawMessage
+	err      *JSONRPCError
+}
+
+// JSONRPCHandler serves JSON-RPC 2.0 at a single path, dispatching by method to handlers
+// that could also be registered in [Web] for REST, with batches and notifications.
+//
+// A method runs with the timeout of its [Handler], within the timeout of JSONRPCHandler for the whole batch,
+// and is only for a [Principal] fulfilling the requirements of its Handler, such as by [RequireRoles].
+// A [CodedError] is responded as -32602 invalid params if it's 400 or 422, -32603 internal error if 5xx,
+// or -32000 server error otherwise, with the status as data, such as 401 or 403 on requirements.
+// Register before the start of serving, as it's not concurrency safe.
+type JSONRPCHandler struct {
+	TimeoutConfig
+	// MaxRequests bounds requests of a batch, zero as 20.
+	MaxRequests int
+	// Concurrency is the max requests of a batch served at the same time, zero as 4.
+	Concurrency int
+	matcher     CanMatch
+	methods     map[string]Handler
+}
+
+// jsonrpcHTTPRequest is the HTTP request carrying a JSON-RPC call, for [Policy] of methods.
+var jsonrpcHTTPRequest = NewContextValue[*http.Request]("JSON-RPC HTTP request")
+
+func NewJSONRPCHandler(matcher CanMatch) *JSONRPCHandler {
+	return &JSONRPCHandler{matcher: matcher, methods: map[string]Handler{}}
+}
+
+// Register adds method, whose params are parsed as JSON into requestType as [NewJSONHandler].
+func (h *JSONRPCHandler) Register(method string, requestType reflect.Type, handler HandleFunc) *JSONRPCHandler {
+	return h.RegisterHandler(method, NewJSONHandler(nil, requestType, handler))
+}
+
+// RegisterHandler adds method served by Parse and Handle of handler, whose output is formatted as JSON,
+// by Format if it's [CanFormat] of JSON. A handler with middlewares or its own [Authenticator] panics,
+// as they're for HTTP requests, which a method is not; use them on JSONRPCHandler instead.
+func (h *JSONRPCHandler) RegisterHandler(method string, handler Handler) *JSONRPCHandler {
+	if len(collectMiddlewares(handler)) > 0 {
+		panic("JSON-RPC method " + method + " has middlewares")
+	}
+	if _, ok := handlerAs[HaveAuthenticator](handler); ok {
+		panic("JSON-RPC method " + method + " has an authenticator")
+	}
+	h.methods[method] = handler
+	return h
+}
+
+func (h *JSONRPCHandler) Match(req *http.Request) bool {
+	return h.matcher.Match(req)
+}
+
+// Middlewares keeps the HTTP request of a call, to check requirements of methods against.
+func (h *JSONRPCHandler) Middlewares() []Middleware {
+	return []Middleware{func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			next.ServeHTTP(writer, request.WithContext(jsonrpcHTTPRequest.Attach(request.Context(), request)))
+		})
+	}}
+}
+
+func (h *JSONRPCHandler) Parse(data []byte, _ string) (any, error) {
+	data = bytes.TrimSpace(data)
+	call := &jsonrpcCall{batch: bytes.HasPrefix(data, []byte("["))}
+	var err error
+	if call.batch {
+		err = json.Unmarshal(data, &call.requests)
+	} else {
+		call.requests = []json.RawMessage{data}
+		if !json.Valid(data) {
+			err = fmt.Errorf("invalid JSON")
+		}
+	}
+	if err != nil {
+		call.err = &JSONRPCError{Code: JSONRPCParseError, Message: "Parse error: " + err.Error()}
+	} else if call.batch && len(call.requests) == 0 {
+		call.err = &JSONRPCError{Code: JSONRPCInvalidRequest, Message: "Invalid Request: empty batch"}
+	} else if limit := cmp.Or(h.MaxRequests, 20); len(call.requests) > limit {
+		call.err = &JSONRPCError{Code: JSONRPCInvalidRequest, Message: fmt.Sprintf("Invalid Request: more than %d in a batch", limit)}
+	}
+	return call, nil
+}
+
+// Handle runs requests of a batch concurrently up to Concurrency, and returns nil if they're all notifications.
+func (h *JSONRPCHandler) Handle(ctx context.Context, req any) (HandleOutputType, *CodedError) {
+	call := req.(*jsonrpcCall)
+	if call.err != nil {
+		return jsonrpcResponse{JSONRPC: "2.0", Error: call.err, ID: json.RawMessage("null")}, nil
+	}
+	responses := make([]*jsonrpcResponse, len(call.requests))
+	sem := make(chan struct{}, cmp.Or(h.Concurrency, 4))
+	var wg sync.WaitGroup
+	for i, raw := range call.requests {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			responses[i] = h.dispatch(ctx, raw)
+		}()
+	}
+	wg.Wait()
+	var ret []jsonrpcResponse
+	for _, r := range responses {
+		if r != nil {
+			ret = append(ret, *r)
+		}
+	}
+	switch {
+	case len(ret) == 0:
+		return nil, nil
+	case !call.batch:
+		return ret[0], nil
+	}
+	return ret, nil
+}
+
+// dispatch serves one request, nil as a notification.
+func (h *JSONRPCHandler) dispatch(ctx context.Context, raw json.RawMessage) (rsp *jsonrpcResponse) {
+	logger := Logger(ctx)
+	var req jsonrpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil || req.JSONRPC != "2.0" || req.Method == "" {
+		return &jsonrpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"),
+			Error: &JSONRPCError{Code: JSONRPCInvalidRequest, Message: "Invalid Request"}}
+	}
+	respond := func(result json.RawMessage, e *JSONRPCError) *jsonrpcResponse {
+		if req.ID == nil {
+			return nil
+		}
+		return &jsonrpcResponse{JSONRPC: "2.0", Result: result, Error: e, ID: req.ID}
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			logger.Error("panic on JSON-RPC", "method", req.Method, "panic", p)
+			rsp = respond(nil, &JSONRPCError{Code: JSONRPCInternalError, Message: "Internal error"})
+		}
+	}()
+
+	handler, ok := h.methods[req.Method]
+	if !ok {
+		return respond(nil, &JSONRPCError{Code: JSONRPCMethodNotFound, Message: "Method not found: " + req.Method})
+	}
+	if e := authorizeMethod(ctx, handler); e != nil {
+		logger.Warn("JSON-RPC "+e.Error(), "method", req.Method)
+		return respond(nil, jsonrpcErrorOf(e))
+	}
+	params := req.Params
+	if len(params) == 0 {
+		params = json.RawMessage("null")
+	}
+	input, err := handler.Parse(params, "")
+	if err != nil {
+		logger.Warn("bad JSON-RPC params", "method", req.Method, "err", err)
+		return respond(nil, &JSONRPCError{Code: JSONRPCInvalidParams, Message: "Invalid params: " + err.Error()})
+	}
+	ctx, cancel := withTimeout(ctx, handler)
+	defer cancel()
+	output, e := handler.Handle(ctx, input)
+	if e != nil {
+		if IsUserFault(e.Code) {
+			logger.Warn("JSON-RPC "+e.Error(), "method", req.Method)
+		} else {
+			logger.Error("JSON-RPC "+e.Error(), "method", req.Method)
+		}
+		return respond(nil, jsonrpcErrorOf(e))
+	}
+	result, err := jsonrpcResult(handler, output)
+	if err != nil {
+		logger.Error("unexpected failure on marshal", "method", req.Method, "err", err)
+		return respond(nil, &JSONRPCError{Code: JSONRPCInternalError, Message: "Internal error"})
+	}
+	return respond(result, nil)
+}
+
+// authorizeMethod checks the principal of ctx against requirements of handler as [Web] does, returning 401 or 403.
+func authorizeMethod(ctx context.Context, handler Handler) *CodedError {
+	requirements := collect[HaveRequirement](handler)
+	if len(requirements) == 0 {
+		return nil
+	}
+	p, ok := DetachPrincipal(ctx)
+	if !ok {
+		return NewCodedErrorf(http.StatusUnauthorized, "authentication required")
+	}
+	request, _ := jsonrpcHTTPRequest.Detach(ctx)
+	for _, hr := range requirements {
+		if err := hr.Requirement().check(ctx, p, request); err != nil {
+			return NewCodedError(http.StatusForbidden, err)
+		}
+	}
+	return nil
+}
+
+func jsonrpcErrorOf(e *CodedError) *JSONRPCError {
+	code := JSONRPCServerError
+	switch {
+	case e.Code == http.StatusBadRequest || e.Code == http.StatusUnprocessableEntity:
+		code = JSONRPCInvalidParams
+	case e.Code >= http.StatusInternalServerError:
+		code = JSONRPCInternalError
+	}
+	return &JSONRPCError{Code: code, Message: e.Err.Error(), Data: map[string]int{"status": e.Code}}
+}
+
+// jsonrpcResult formats output by handler if it formats JSON, or marshals it otherwise.
+func jsonrpcResult(handler Handler, output any) (json.RawMessage, error) {
+	var data []byte
+	var err error
+	f, ok := handler.(CanFormat)
+	if ct, isCT := handler.(HasResponseContentType); ok && (!isCT || strings.HasPrefix(ct.ResponseContentType(), "application/json")) {
+		data, err = f.Format(output)
+	} else {
+		data, err = json.Marshal(output)
+	}
+	if len(data) == 0 {
+		data = []byte("null")
+	}
+	return data, err
+}
+
+func (h *JSONRPCHandler) Response(output HandleOutputType, writer http.ResponseWriter) {
+	if output == nil {
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+	data, err := json.Marshal(output)
+	if err != nil {
+		writerLogger(writer).Error("unexpected failure on marshal", "err", err)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", JSONContentType)
+	_, _ = writer.Write(data)
+}
+
+func (h *JSONRPCHandler) Describe() Route {
+	return Route{
+		Pattern:     DescribeMatch(h.matcher),
+		Handler:     "jsonrpc: " + strings.Join(slices.Sorted(maps.Keys(h.methods)), ", "),
+		Timeout:     h.Timeout,
+		ContentType: JSONContentType,
+	}
+}
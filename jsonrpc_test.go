@@ -0,0 +1,184 @@
+package wf
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type sumReq struct {
+	A, B int
+}
+
+func TestJSONRPCHandler(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	notified := make(chan string, 1)
+	sum := func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		r := req.(*sumReq)
+		if r.A < 0 {
+			return nil, NewCodedErrorf(http.StatusBadRequest, "negative %d", r.A)
+		}
+		return r.A + r.B, nil
+	}
+	slow := NewJSONHandler(nil, reflect.TypeOf(Empty{}), func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		<-ctx.Done()
+		return nil, NewCodedError(http.StatusGatewayTimeout, context.Cause(ctx))
+	})
+	slow.Timeout = 10 * time.Millisecond
+	rpc := NewJSONRPCHandler(Exact(http.MethodPost, "/rpc")).
+		Register("sum", reflect.TypeOf(sumReq{}), sum).
+		Register("log", reflect.TypeOf(""), func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+			notified <- *req.(*string)
+			return nil, nil
+		}).
+		RegisterHandler("slow", slow)
+	web := NewWeb(false, rpc, NewJSONHandler(Exact(http.MethodPost, "/sum"), reflect.TypeOf(sumReq{}), sum))
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		want   string
+	}{
+		{"call", `{"jsonrpc":"2.0","method":"sum","params":{"A":1,"B":2},"id":1}`, http.StatusOK,
+			`{"jsonrpc":"2.0","result":3,"id":1}`},
+		{"coded error", `{"jsonrpc":"2.0","method":"sum","params":{"A":-1},"id":"a"}`, http.StatusOK,
+			`{"jsonrpc":"2.0","error":{"code":-32602,"message":"negative -1","data":{"status":400}},"id":"a"}`},
+		{"notification", `{"jsonrpc":"2.0","method":"log","params":"hi"}`, http.StatusNoContent, ``},
+		{"parse error", `{"jsonrpc"`, http.StatusOK,
+			`{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error: invalid JSON"},"id":null}`},
+		{"batch", `[
+			{"jsonrpc":"2.0","method":"sum","params":{"A":2,"B":2},"id":1},
+			{"jsonrpc":"2.0","method":"nope","id":2},
+			{"jsonrpc":"1.0","method":"sum","id":3},
+			{"jsonrpc":"2.0","method":"sum","params":[1,2],"id":4},
+			{"jsonrpc":"2.0","method":"slow","id":5}
+		]`, http.StatusOK, `[` +
+			`{"jsonrpc":"2.0","result":4,"id":1},` +
+			`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found: nope"},"id":2},` +
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null},` +
+			`{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params: json: cannot unmarshal array into Go value of type wf.sumReq"},"id":4},` +
+			`{"jsonrpc":"2.0","error":{"code":-32603,"message":"handler exceed timeout 10ms","data":{"status":504}},"id":5}` +
+			`]`},
+		{"empty batch", `[]`, http.StatusOK,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request: empty batch"},"id":null}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			web.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(tt.body)))
+			if recorder.Code != tt.status || recorder.Body.String() != tt.want {
+				t.Errorf("want %d %s, got %d %s", tt.status, tt.want, recorder.Code, recorder.Body)
+			}
+		})
+	}
+	if got := <-notified; got != "hi" {
+		t.Errorf("want notified, got %q", got)
+	}
+
+	recorder := httptest.NewRecorder()
+	web.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/sum", strings.NewReader(`{"A":1,"B":2}`)))
+	if recorder.Body.String() != "3" {
+		t.Errorf("want the same HandleFunc over REST, got %q", recorder.Body)
+	}
+	if r := rpc.Describe(); r.Handler != "jsonrpc: log, slow, sum" {
+		t.Errorf("unexpected route %+v", r)
+	}
+}
+
+func TestJSONRPCRequirements(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	secret := func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		return "secret", nil
+	}
+	notBob := func(_ context.Context, p *Principal, req *http.Request) error {
+		if p.Subject == "bob" || req.URL.Path != "/rpc" {
+			return errors.New("not for bob")
+		}
+		return nil
+	}
+	rpc := NewJSONRPCHandler(Exact(http.MethodPost, "/rpc")).
+		RegisterHandler("secret", RequireRoles(NewJSONHandler(nil, reflect.TypeOf(Empty{}), secret), "admin")).
+		RegisterHandler("policy", RequirePolicy(NewJSONHandler(nil, reflect.TypeOf(Empty{}), secret), "notBob", notBob))
+	web := NewWeb(false, rpc)
+	web.SetAuthenticator(Optional(TokenAuth(func(_ context.Context, credential string) (*Principal, error) {
+		return map[string]*Principal{
+			"admin": {Subject: "alice", Roles: []string{"admin"}},
+			"user":  {Subject: "bob", Roles: []string{"user"}},
+		}[credential], nil
+	})))
+
+	tests := []struct {
+		name   string
+		method string
+		token  string
+		want   string
+	}{
+		{"admin", "secret", "admin", `{"jsonrpc":"2.0","result":"secret","id":1}`},
+		{"anonymous", "secret", "", `{"jsonrpc":"2.0","error":{"code":-32000,"message":"authentication required","data":{"status":401}},"id":1}`},
+		{"not admin", "secret", "user", `{"jsonrpc":"2.0","error":{"code":-32000,"message":"requires any role of [admin]","data":{"status":403}},"id":1}`},
+		{"policy", "policy", "admin", `{"jsonrpc":"2.0","result":"secret","id":1}`},
+		{"policy denied", "policy", "user", `{"jsonrpc":"2.0","error":{"code":-32000,"message":"not for bob","data":{"status":403}},"id":1}`},
+	}
+	for _, tt := range tests {
+		request := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(`{"jsonrpc":"2.0","method":"`+tt.method+`","id":1}`))
+		if tt.token != "" {
+			request.Header.Set("Token", tt.token)
+		}
+		recorder := httptest.NewRecorder()
+		web.ServeHTTP(recorder, request)
+		if recorder.Body.String() != tt.want {
+			t.Errorf("%s: want %s, got %d %s", tt.name, tt.want, recorder.Code, recorder.Body)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("want a panic on a method with middlewares")
+		}
+	}()
+	rpc.RegisterHandler("limited", WithMiddlewares(NewJSONHandler(nil, reflect.TypeOf(Empty{}), secret), RateLimiter(RateLimit{Limit: 1, Window: time.Minute})))
+}
+
+func TestJSONRPCBatchBounds(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	var running, peak atomic.Int32
+	rpc := NewJSONRPCHandler(Exact(http.MethodPost, "/rpc")).
+		Register("wait", reflect.TypeOf(Empty{}), func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+			}
+			time.Sleep(5 * time.Millisecond)
+			return nil, nil
+		})
+	rpc.MaxRequests, rpc.Concurrency = 8, 2
+	web := NewWeb(false, rpc)
+	call := func(n int) *httptest.ResponseRecorder {
+		body := "[" + strings.Repeat(`{"jsonrpc":"2.0","method":"wait","id":1},`, n)
+		recorder := httptest.NewRecorder()
+		web.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(strings.TrimSuffix(body, ",")+"]")))
+		return recorder
+	}
+
+	if r := call(8); r.Code != http.StatusOK || strings.Count(r.Body.String(), `"result":null`) != 8 {
+		t.Errorf("want 8 results, got %d %s", r.Code, r.Body)
+	}
+	if got := peak.Load(); got != 2 {
+		t.Errorf("want at most 2 at the same time, got %d", got)
+	}
+	want := `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request: more than 8 in a batch"},"id":null}`
+	if r := call(9); r.Body.String() != want {
+		t.Errorf("want %s, got %s", want, r.Body)
+	}
+}
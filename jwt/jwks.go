@@ -0,0 +1,166 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// Key is a key of one algorithm, identified by ID as kid. A key without the private part could only verify.
+type Key struct {
+	ID        string
+	Algorithm string
+	secret    []byte
+	edPublic  ed25519.PublicKey
+	edPrivate ed25519.PrivateKey
+	ecPublic  *ecdsa.PublicKey
+	ecPrivate *ecdsa.PrivateKey
+}
+
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{ID: id, Algorithm: HS256, secret: secret}
+}
+
+// NewEd25519Key creates an EdDSA key, whose private is nil to only verify.
+func NewEd25519Key(id string, public ed25519.PublicKey, private ed25519.PrivateKey) *Key {
+	return &Key{ID: id, Algorithm: EdDSA, edPublic: public, edPrivate: private}
+}
+
+// NewES256Key creates an ES256 key on P-256, whose private is nil to only verify.
+func NewES256Key(id string, public *ecdsa.PublicKey, private *ecdsa.PrivateKey) *Key {
+	return &Key{ID: id, Algorithm: ES256, ecPublic: public, ecPrivate: private}
+}
+
+// Keyset indexes keys by kid, which enables key rotation, as tokens signed by an old key remain valid
+// until it's removed from the set, while new tokens are signed by the new key.
+type Keyset struct {
+	keys map[string]*Key
+}
+
+func NewKeyset(keys ...*Key) *Keyset {
+	ks := &Keyset{keys: map[string]*Key{}}
+	for _, k := range keys {
+		ks.keys[k.ID] = k
+	}
+	return ks
+}
+
+func (ks *Keyset) Key(id string) (*Key, bool) {
+	k, ok := ks.keys[id]
+	return k, ok
+}
+
+// find returns the key of id, where an empty id is only acceptable if there is only one key.
+func (ks *Keyset) find(id string) (*Key, error) {
+	if ks == nil {
+		return nil, ErrUnknownKey
+	}
+	if id == "" && len(ks.keys) == 1 {
+		for _, k := range ks.keys {
+			return k, nil
+		}
+	}
+	k, ok := ks.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	return k, nil
+}
+
+// jwk is the subset of RFC 7517 and RFC 8037 used by the supported algorithms.
+type jwk struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv"`
+	K         string `json:"k"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+	D         string `json:"d"`
+}
+
+// LoadJWKS reads a local JWKS file, call it again and [Verifier.SetKeyset] to rotate keys.
+func LoadJWKS(path string) (*Keyset, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// ParseJWKS parses a JWK Set, with keys of kty oct, OKP on Ed25519 and EC on P-256.
+// A key with d, or oct that is symmetric, could also sign.
+func ParseJWKS(data []byte) (*Keyset, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&set); err != nil {
+		return nil, err
+	}
+	var keys []*Key
+	for i, j := range set.Keys {
+		k, err := j.key()
+		if err != nil {
+			return nil, fmt.Errorf("key #%d %q: %w", i, j.KeyID, err)
+		}
+		keys = append(keys, k)
+	}
+	return NewKeyset(keys...), nil
+}
+
+func (j jwk) key() (*Key, error) {
+	var fields [4][]byte
+	for i, s := range []string{j.K, j.X, j.Y, j.D} {
+		b, err := encoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = b
+	}
+	k, x, y, d := fields[0], fields[1], fields[2], fields[3]
+
+	var key *Key
+	switch {
+	case j.KeyType == "oct":
+		if len(k) == 0 {
+			return nil, fmt.Errorf("empty k")
+		}
+		key = NewHMACKey(j.KeyID, k)
+	case j.KeyType == "OKP" && j.Curve == "Ed25519":
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("bad x size %d", len(x))
+		}
+		var private ed25519.PrivateKey
+		if len(d) > 0 {
+			if len(d) != ed25519.SeedSize {
+				return nil, fmt.Errorf("bad d size %d", len(d))
+			}
+			private = ed25519.NewKeyFromSeed(d)
+		}
+		key = NewEd25519Key(j.KeyID, x, private)
+	case j.KeyType == "EC" && j.Curve == "P-256":
+		// Validate the point through ecdh, as the fields of ecdsa.PublicKey are not checked on use.
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, err
+		}
+		public := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		var private *ecdsa.PrivateKey
+		if len(d) > 0 {
+			private = &ecdsa.PrivateKey{PublicKey: *public, D: new(big.Int).SetBytes(d)}
+		}
+		key = NewES256Key(j.KeyID, public, private)
+	default:
+		return nil, fmt.Errorf("unsupported kty %q crv %q", j.KeyType, j.Curve)
+	}
+	if j.Algorithm != "" && j.Algorithm != key.Algorithm {
+		return nil, fmt.Errorf("%w %s for kty %s", ErrAlgorithm, j.Algorithm, j.KeyType)
+	}
+	return key, nil
+}
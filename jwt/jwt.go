@@ -0,0 +1,334 @@
+// Package jwt verifies and issues JSON Web Tokens with HS256, EdDSA and ES256, using only the standard library.
+//
+// Use [Authenticator] to authenticate requests of [wf.Web] with `Authorization: Bearer <jwt>`,
+// and [DetachClaims] in a [wf.HandleFunc] to fetch the verified claims.
+package jwt
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hyisen/wf"
+)
+
+const (
+	HS256 = "HS256"
+	EdDSA = "EdDSA"
+	ES256 = "ES256"
+)
+
+var (
+	ErrMalformed    = errors.New("malformed token")
+	ErrAlgorithm    = errors.New("unexpected algorithm")
+	ErrUnknownKey   = errors.New("unknown key")
+	ErrSignature    = errors.New("invalid signature")
+	ErrExpired      = errors.New("token expired")
+	ErrNotYetValid  = errors.New("token not yet valid")
+	ErrIssuer       = errors.New("unexpected issuer")
+	ErrAudience     = errors.New("unexpected audience")
+	ErrNotSignerKey = errors.New("key has no private part to sign")
+)
+
+// Audience is a single string or an array of strings in JSON, as RFC 7519 allows both.
+type Audience []string
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+// Claims are the registered claims, plus roles and scope which are resolved into [wf.Principal].
+// Times are seconds since epoch, zero as absent.
+type Claims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	Scope     string   `json:"scope,omitempty"` // space-separated, as RFC 8693
+	// Extra is the other claims, filled on verification and merged on issuance.
+	Extra map[string]any `json:"-"`
+}
+
+// claims is Claims without methods, to avoid recursion in (un)marshal.
+type claims Claims
+
+func (c Claims) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(claims(c))
+	if err != nil || len(c.Extra) == 0 {
+		return data, err
+	}
+	merged := map[string]any{}
+	for k, v := range c.Extra {
+		merged[k] = v
+	}
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+	return json.Marshal(merged)
+}
+
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*claims)(c)); err != nil {
+		return err
+	}
+	var all map[string]any
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+	for _, registered := range []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti", "roles", "scope"} {
+		delete(all, registered)
+	}
+	if len(all) > 0 {
+		c.Extra = all
+	}
+	return nil
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+var encoding = base64.RawURLEncoding
+
+// Sign issues a token of claims signed by key, whose ID is put in the header as kid.
+func Sign(key *Key, claims Claims) (string, error) {
+	if !key.canSign() {
+		return "", ErrNotSignerKey
+	}
+	h, err := json.Marshal(header{Algorithm: key.Algorithm, Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := encoding.EncodeToString(h) + "." + encoding.EncodeToString(payload)
+	signature, err := key.sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + encoding.EncodeToString(signature), nil
+}
+
+// Issuer is a helper to issue tokens in a login handler, filling the claims it manages.
+type Issuer struct {
+	Key      *Key
+	Issuer   string
+	Audience []string
+	TTL      time.Duration
+}
+
+// Issue signs claims with iss, aud, iat, nbf and exp filled if absent, whose time comes from [wf.Now].
+func (i *Issuer) Issue(ctx context.Context, claims Claims) (string, error) {
+	now := wf.Now(ctx)
+	if claims.Issuer == "" {
+		claims.Issuer = i.Issuer
+	}
+	if len(claims.Audience) == 0 {
+		claims.Audience = i.Audience
+	}
+	if claims.IssuedAt == 0 {
+		claims.IssuedAt = now.Unix()
+	}
+	if claims.NotBefore == 0 {
+		claims.NotBefore = now.Unix()
+	}
+	if claims.ExpiresAt == 0 && i.TTL != 0 {
+		claims.ExpiresAt = now.Add(i.TTL).Unix()
+	}
+	return Sign(i.Key, claims)
+}
+
+// Verifier verifies tokens with keys indexed by kid, which could be replaced on key rotation.
+type Verifier struct {
+	keys atomic.Pointer[Keyset]
+	// Issuer is the required iss, empty as any.
+	Issuer string
+	// Audience is required to be one of aud, empty as any.
+	Audience string
+	// Leeway is the tolerated clock skew on exp and nbf.
+	Leeway time.Duration
+}
+
+func NewVerifier(keys *Keyset) *Verifier {
+	v := &Verifier{}
+	v.SetKeyset(keys)
+	return v
+}
+
+// SetKeyset replaces the keys, such as reloaded by [LoadJWKS], which is concurrency safe.
+func (v *Verifier) SetKeyset(keys *Keyset) {
+	v.keys.Store(keys)
+}
+
+// Verify checks the signature and the claims of token, whose time comes from [wf.Now].
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	var h header
+	if err := decodeJSON(parts[0], &h); err != nil {
+		return nil, err
+	}
+	key, err := v.keys.Load().find(h.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	// Never trust alg in header alone, or an attacker could sign with a public key as an HMAC secret.
+	if h.Algorithm != key.Algorithm {
+		return nil, fmt.Errorf("%w %s for key %q", ErrAlgorithm, h.Algorithm, key.ID)
+	}
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrSignature
+	}
+
+	var c Claims
+	if err := decodeJSON(parts[1], &c); err != nil {
+		return nil, err
+	}
+	now := wf.Now(ctx)
+	if c.ExpiresAt != 0 && !now.Before(time.Unix(c.ExpiresAt, 0).Add(v.Leeway)) {
+		return nil, ErrExpired
+	}
+	if c.NotBefore != 0 && now.Add(v.Leeway).Before(time.Unix(c.NotBefore, 0)) {
+		return nil, ErrNotYetValid
+	}
+	if v.Issuer != "" && c.Issuer != v.Issuer {
+		return nil, fmt.Errorf("%w %q", ErrIssuer, c.Issuer)
+	}
+	if v.Audience != "" && !slices.Contains(c.Audience, v.Audience) {
+		return nil, fmt.Errorf("%w %q", ErrAudience, c.Audience)
+	}
+	return &c, nil
+}
+
+func decodeJSON(part string, v any) error {
+	data, err := encoding.DecodeString(part)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	return nil
+}
+
+// Authenticator authenticates with `Authorization: Bearer <jwt>` verified by v.
+// The resolved [wf.Principal] has roles and scope from the claims, which are its Credential.
+func Authenticator(realm string, v *Verifier) wf.Authenticator {
+	return wf.BearerAuth(realm, func(ctx context.Context, token string) (*wf.Principal, error) {
+		c, err := v.Verify(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		return &wf.Principal{
+			Subject:    c.Subject,
+			Roles:      c.Roles,
+			Scopes:     strings.Fields(c.Scope),
+			Credential: c,
+		}, nil
+	})
+}
+
+// DetachClaims returns the claims of the token that authenticated the request through [Authenticator].
+func DetachClaims(ctx context.Context) (*Claims, bool) {
+	p, ok := wf.DetachPrincipal(ctx)
+	if !ok {
+		return nil, false
+	}
+	c, ok := p.Credential.(*Claims)
+	return c, ok
+}
+
+func (k *Key) canSign() bool {
+	switch k.Algorithm {
+	case HS256:
+		return len(k.secret) > 0
+	case EdDSA:
+		return k.edPrivate != nil
+	case ES256:
+		return k.ecPrivate != nil
+	}
+	return false
+}
+
+func (k *Key) sign(signingInput []byte) ([]byte, error) {
+	switch k.Algorithm {
+	case HS256:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(signingInput)
+		return mac.Sum(nil), nil
+	case EdDSA:
+		return ed25519.Sign(k.edPrivate, signingInput), nil
+	case ES256:
+		digest := sha256.Sum256(signingInput)
+		r, s, err := ecdsa.Sign(rand.Reader, k.ecPrivate, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		// JWS uses the fixed-size R || S rather than ASN.1, see RFC 7518 section 3.4.
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return signature, nil
+	}
+	return nil, fmt.Errorf("%w %s", ErrAlgorithm, k.Algorithm)
+}
+
+func (k *Key) verify(signingInput []byte, signature []byte) bool {
+	switch k.Algorithm {
+	case HS256:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(signingInput)
+		return hmac.Equal(signature, mac.Sum(nil))
+	case EdDSA:
+		return len(signature) == ed25519.SignatureSize && ed25519.Verify(k.edPublic, signingInput, signature)
+	case ES256:
+		if len(signature) != 64 {
+			return false
+		}
+		digest := sha256.Sum256(signingInput)
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(k.ecPublic, digest[:], r, s)
+	}
+	return false
+}
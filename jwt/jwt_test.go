@@ -0,0 +1,194 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hyisen/wf"
+	"github.com/hyisen/wf/wftest"
+)
+
+func newKeys(t *testing.T) []*Key {
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPrivate, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []*Key{
+		NewHMACKey("hs", []byte("0123456789abcdef0123456789abcdef")),
+		NewEd25519Key("ed", edPublic, edPrivate),
+		NewES256Key("ec", &ecPrivate.PublicKey, ecPrivate),
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	ctx := wf.AttachClock(context.Background(), func() time.Time { return now })
+	keys := newKeys(t)
+	v := NewVerifier(NewKeyset(keys...))
+	v.Issuer = "wf"
+	v.Audience = "api"
+	v.Leeway = time.Minute
+
+	for _, key := range keys {
+		t.Run(key.Algorithm, func(t *testing.T) {
+			issuer := &Issuer{Key: key, Issuer: "wf", Audience: []string{"api", "other"}, TTL: time.Hour}
+			token, err := issuer.Issue(ctx, Claims{Subject: "alice", Extra: map[string]any{"tenant": "t1"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, err := v.Verify(ctx, token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Subject != "alice" || c.Extra["tenant"] != "t1" || c.ExpiresAt != now.Add(time.Hour).Unix() {
+				t.Errorf("unexpected claims %+v", c)
+			}
+
+			late := wf.AttachClock(ctx, func() time.Time { return now.Add(time.Hour + time.Minute) })
+			if _, err := v.Verify(late, token); !errors.Is(err, ErrExpired) {
+				t.Errorf("want expired, got %v", err)
+			}
+			skewed := wf.AttachClock(ctx, func() time.Time { return now.Add(time.Hour + time.Second) })
+			if _, err := v.Verify(skewed, token); err != nil {
+				t.Errorf("want valid within leeway, got %v", err)
+			}
+
+			tampered := token[:len(token)-4] + "AAAA"
+			if _, err := v.Verify(ctx, tampered); !errors.Is(err, ErrSignature) && !errors.Is(err, ErrMalformed) {
+				t.Errorf("want invalid signature, got %v", err)
+			}
+		})
+	}
+
+	sign := func(claims Claims) string {
+		token, err := Sign(keys[0], claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	tests := []struct {
+		name   string
+		claims Claims
+		want   error
+	}{
+		{"not yet", Claims{Issuer: "wf", Audience: Audience{"api"}, NotBefore: now.Add(2 * time.Minute).Unix()}, ErrNotYetValid},
+		{"issuer", Claims{Issuer: "evil", Audience: Audience{"api"}}, ErrIssuer},
+		{"audience", Claims{Issuer: "wf", Audience: Audience{"other"}}, ErrAudience},
+	}
+	for _, tt := range tests {
+		if _, err := v.Verify(ctx, sign(tt.claims)); !errors.Is(err, tt.want) {
+			t.Errorf("%s want %v, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestAlgorithmConfusion(t *testing.T) {
+	keys := newKeys(t)
+	// A token signed by the HMAC key, but claiming to be of the Ed25519 key.
+	forged := NewHMACKey("ed", keys[0].secret)
+	token, err := Sign(forged, Claims{Subject: "mallory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewVerifier(NewKeyset(keys...)).Verify(context.Background(), token); !errors.Is(err, ErrAlgorithm) {
+		t.Errorf("want algorithm error, got %v", err)
+	}
+}
+
+func TestJWKSRotation(t *testing.T) {
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPrivate, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := encoding.EncodeToString
+	old := fmt.Sprintf(`{"kty":"OKP","crv":"Ed25519","kid":"2023","alg":"EdDSA","x":%q,"d":%q}`,
+		b64(edPublic), b64(edPrivate.Seed()))
+	current := fmt.Sprintf(`{"kty":"EC","crv":"P-256","kid":"2024","x":%q,"y":%q,"d":%q}`,
+		b64(ecPrivate.X.FillBytes(make([]byte, 32))), b64(ecPrivate.Y.FillBytes(make([]byte, 32))), b64(ecPrivate.D.FillBytes(make([]byte, 32))))
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	write := func(keys string) *Keyset {
+		if err := os.WriteFile(path, []byte(`{"keys":[`+keys+`]}`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		ks, err := LoadJWKS(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ks
+	}
+
+	ks := write(old)
+	v := NewVerifier(ks)
+	oldKey, _ := ks.Key("2023")
+	oldToken, err := Sign(oldKey, Claims{Subject: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks = write(old + "," + current)
+	v.SetKeyset(ks)
+	newKey, _ := ks.Key("2024")
+	newToken, err := Sign(newKey, Claims{Subject: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{oldToken, newToken} {
+		if _, err := v.Verify(context.Background(), token); err != nil {
+			t.Errorf("want valid during rotation, got %v", err)
+		}
+	}
+
+	v.SetKeyset(write(current))
+	if _, err := v.Verify(context.Background(), oldToken); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("want unknown key after rotation, got %v", err)
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	key := newKeys(t)[1]
+	v := NewVerifier(NewKeyset(key))
+	handler := wf.WithAuthenticator(wf.NewClosureHandler(
+		wf.Exact(http.MethodGet, "/me"),
+		wf.ParseEmpty,
+		func(ctx context.Context, req any) (rsp any, codedError *wf.CodedError) {
+			c, ok := DetachClaims(ctx)
+			if !ok {
+				return nil, wf.NewCodedErrorf(http.StatusInternalServerError, "no claims")
+			}
+			return c.Subject + " " + c.Scope, nil
+		},
+		func(output any) (data []byte, err error) {
+			return []byte(output.(string)), nil
+		},
+		"text/plain",
+	), Authenticator("api", v))
+	token, err := Sign(key, Claims{Subject: "alice", Scope: "read write"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := wftest.NewHandler(t, handler)
+	h.Get("/me").Header("Authorization", "Bearer "+token).Do().AssertStatus(http.StatusOK).AssertBody("alice read write")
+	h.Get("/me").Header("Authorization", "Bearer x.y.z").Do().
+		AssertStatus(http.StatusUnauthorized).
+		AssertHeader("WWW-Authenticate", `Bearer realm="api"`)
+}
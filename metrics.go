@@ -0,0 +1,229 @@
+package wf
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsContentType is the Prometheus text exposition format.
+const MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	// DefaultLatencyBuckets are the upper bounds in seconds of the request duration histogram.
+	DefaultLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// DefaultSizeBuckets are the upper bounds in bytes of the response size histogram.
+	DefaultSizeBuckets = []float64{100, 1e3, 1e4, 1e5, 1e6, 1e7}
+)
+
+// unmatchedRoute labels requests that no handler matches.
+const unmatchedRoute = "unmatched"
+
+// Metrics collects what [Web] serves, keyed by route pattern rather than raw path to bound the cardinality,
+// along with the handler name and [RouteID] for a custom matcher.
+// It's an [http.Handler] that exposes them in Prometheus text format, which could be registered by [Mount].
+//
+//	metrics := wf.NewMetrics()
+//	web := wf.NewWeb(false, wf.Mount(wf.Exact(http.MethodGet, "/metrics"), metrics), ...)
+//	web.SetMetrics(metrics)
+type Metrics struct {
+	LatencyBuckets []float64
+	SizeBuckets    []float64
+
+	mu     sync.Mutex
+	routes map[routeKey]*routeMetrics
+}
+
+type routeKey struct {
+	method string
+	route  string
+}
+
+type routeMetrics struct {
+	requests     map[string]uint64 // by status class, such as 2xx
+	duration     histogram
+	size         histogram
+	inFlight     int64
+	timeouts     uint64
+	streams      int64
+	streamsTotal uint64
+}
+
+type histogram struct {
+	counts []uint64 // by bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(buckets []float64, v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(buckets))
+	}
+	if i, _ := slices.BinarySearch(buckets, v); i < len(buckets) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		LatencyBuckets: DefaultLatencyBuckets,
+		SizeBuckets:    DefaultSizeBuckets,
+		routes:         map[routeKey]*routeMetrics{},
+	}
+}
+
+// SetMetrics makes every request collected into m, nil as none.
+// Better to use before the start of serving, as it's not concurrency safe.
+func (w *Web) SetMetrics(m *Metrics) {
+	w.metrics = m
+}
+
+func keyOf(route Route, matched bool) routeKey {
+	if !matched {
+		return routeKey{method: "*", route: unmatchedRoute}
+	}
+	return routeKey{method: cmp.Or(route.Pattern.Method, "*"), route: route.label()}
+}
+
+// get returns the metrics of key, which must be called with mu locked.
+func (m *Metrics) get(key routeKey) *routeMetrics {
+	rm, ok := m.routes[key]
+	if !ok {
+		rm = &routeMetrics{requests: map[string]uint64{}}
+		m.routes[key] = rm
+	}
+	return rm
+}
+
+func (m *Metrics) enter(key routeKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.get(key).inFlight++
+}
+
+// exit records a request of key entered before, responded with status and written bytes.
+func (m *Metrics) exit(key routeKey, status int, written int64, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rm := m.get(key)
+	rm.inFlight--
+	rm.requests[strconv.Itoa(status/100)+"xx"]++
+	rm.duration.observe(m.LatencyBuckets, elapsed.Seconds())
+	rm.size.observe(m.SizeBuckets, float64(written))
+}
+
+func (m *Metrics) timeout(key routeKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.get(key).timeouts++
+}
+
+// stream records a Server-Sent Events stream of key, until the returned function is called.
+func (m *Metrics) stream(key routeKey) func() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rm := m.get(key)
+	rm.streams++
+	rm.streamsTotal++
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		rm.streams--
+	}
+}
+
+func (m *Metrics) ServeHTTP(writer http.ResponseWriter, _ *http.Request) {
+	writer.Header().Set("Content-Type", MetricsContentType)
+	_ = m.Expose(writer)
+}
+
+// Expose writes all metrics in Prometheus text format.
+func (m *Metrics) Expose(writer io.Writer) error {
+	m.mu.Lock()
+	keys := make([]routeKey, 0, len(m.routes))
+	snapshot := make(map[routeKey]routeMetrics, len(m.routes))
+	for k, rm := range m.routes {
+		keys = append(keys, k)
+		copied := *rm
+		copied.requests = make(map[string]uint64, len(rm.requests))
+		for class, n := range rm.requests {
+			copied.requests[class] = n
+		}
+		copied.duration.counts = slices.Clone(rm.duration.counts)
+		copied.size.counts = slices.Clone(rm.size.counts)
+		snapshot[k] = copied
+	}
+	m.mu.Unlock()
+	slices.SortFunc(keys, func(a, b routeKey) int {
+		return cmp.Or(strings.Compare(a.route, b.route), strings.Compare(a.method, b.method))
+	})
+
+	var sb strings.Builder
+	family := func(name string, kind string, help string, each func(rm routeMetrics, labels string)) {
+		_, _ = fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for _, k := range keys {
+			each(snapshot[k], fmt.Sprintf(`method="%s",route="%s"`, escapeLabel(k.method), escapeLabel(k.route)))
+		}
+	}
+	family("wf_requests_total", "counter", "Requests served, by route and status class.", func(rm routeMetrics, labels string) {
+		classes := make([]string, 0, len(rm.requests))
+		for class := range rm.requests {
+			classes = append(classes, class)
+		}
+		slices.Sort(classes)
+		for _, class := range classes {
+			_, _ = fmt.Fprintf(&sb, "wf_requests_total{%s,code=\"%s\"} %d\n", labels, class, rm.requests[class])
+		}
+	})
+	family("wf_request_duration_seconds", "histogram", "Latency of requests served.", func(rm routeMetrics, labels string) {
+		writeHistogram(&sb, "wf_request_duration_seconds", labels, m.LatencyBuckets, rm.duration)
+	})
+	family("wf_response_size_bytes", "histogram", "Size of response bodies written.", func(rm routeMetrics, labels string) {
+		writeHistogram(&sb, "wf_response_size_bytes", labels, m.SizeBuckets, rm.size)
+	})
+	family("wf_requests_in_flight", "gauge", "Requests being served.", func(rm routeMetrics, labels string) {
+		_, _ = fmt.Fprintf(&sb, "wf_requests_in_flight{%s} %d\n", labels, rm.inFlight)
+	})
+	family("wf_timeouts_total", "counter", "Requests that exceeded the timeout of their handler.", func(rm routeMetrics, labels string) {
+		_, _ = fmt.Fprintf(&sb, "wf_timeouts_total{%s} %d\n", labels, rm.timeouts)
+	})
+	family("wf_sse_streams", "gauge", "Server-Sent Events streams being sent.", func(rm routeMetrics, labels string) {
+		if rm.streamsTotal > 0 {
+			_, _ = fmt.Fprintf(&sb, "wf_sse_streams{%s} %d\n", labels, rm.streams)
+		}
+	})
+	family("wf_sse_streams_total", "counter", "Server-Sent Events streams started.", func(rm routeMetrics, labels string) {
+		if rm.streamsTotal > 0 {
+			_, _ = fmt.Fprintf(&sb, "wf_sse_streams_total{%s} %d\n", labels, rm.streamsTotal)
+		}
+	})
+	_, err := io.WriteString(writer, sb.String())
+	return err
+}
+
+func writeHistogram(sb *strings.Builder, name string, labels string, buckets []float64, h histogram) {
+	var cumulative uint64
+	for i, bound := range buckets {
+		if i < len(h.counts) {
+			cumulative += h.counts[i]
+		}
+		_, _ = fmt.Fprintf(sb, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+	}
+	_, _ = fmt.Fprintf(sb, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+	_, _ = fmt.Fprintf(sb, "%s_sum{%s} %s\n", name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	_, _ = fmt.Fprintf(sb, "%s_count{%s} %d\n", name, labels, h.count)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
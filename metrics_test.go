@@ -0,0 +1,107 @@
+package wf
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	metrics := NewMetrics()
+	matcher := ResourceWithID(http.MethodGet, "/items/", "")
+	web := NewWeb(false,
+		Mount(Exact(http.MethodGet, "/metrics"), metrics),
+		NewClosureHandler(matcher, ParseEmpty, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+			return "item", nil
+		}, func(output any) ([]byte, error) {
+			return []byte(output.(string)), nil
+		}, "text/plain"),
+		NewEchoHandler("/slow", 10*time.Millisecond, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+			<-ctx.Done()
+			return nil, NewCodedError(http.StatusGatewayTimeout, context.Cause(ctx))
+		}),
+		NewServerSentEventsHandler(Exact(http.MethodGet, "/events"), ParseEmpty,
+			func(ctx context.Context, req any) (<-chan MessageEvent, *CodedError) {
+				ch := make(chan MessageEvent, 1)
+				ch <- MessageEvent{Lines: []string{"hi"}}
+				close(ch)
+				return ch, nil
+			}),
+	)
+	web.SetMetrics(metrics)
+
+	for _, target := range []string{"/items/1", "/items/2", "/slow", "/events", "/missing"} {
+		web.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+	recorder := httptest.NewRecorder()
+	web.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := recorder.Header().Get("Content-Type"); ct != MetricsContentType {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	body := recorder.Body.String()
+	for _, line := range []string{
+		`wf_requests_total{method="GET",route="/items/{id}",code="2xx"} 2`,
+		`wf_request_duration_seconds_count{method="GET",route="/items/{id}"} 2`,
+		`wf_response_size_bytes_bucket{method="GET",route="/items/{id}",le="100"} 2`,
+		`wf_response_size_bytes_sum{method="GET",route="/items/{id}"} 8`,
+		`wf_requests_total{method="GET",route="/slow",code="5xx"} 1`,
+		`wf_timeouts_total{method="GET",route="/slow"} 1`,
+		`wf_timeouts_total{method="GET",route="/items/{id}"} 0`,
+		`wf_sse_streams{method="GET",route="/events"} 0`,
+		`wf_sse_streams_total{method="GET",route="/events"} 1`,
+		`wf_requests_total{method="*",route="unmatched",code="4xx"} 1`,
+		`wf_requests_in_flight{method="GET",route="/metrics"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("want line %s in\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, "/items/1") {
+		t.Errorf("want raw path never in labels\n%s", body)
+	}
+}
+
+func TestMetricsOfOpaqueRoutes(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	metrics := NewMetrics()
+	// Both from one factory, so that the handlers have the same name.
+	variant := func(value string) Handler {
+		return NewJSONHandler(MatchFunc(func(req *http.Request) bool {
+			return req.Header.Get("X-Variant") == value
+		}), reflect.TypeOf(Empty{}), func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+			return value, nil
+		})
+	}
+	web := NewWeb(false, variant("a"), variant("b"))
+	web.SetMetrics(metrics)
+	for _, variant := range []string{"a", "b"} {
+		request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}"))
+		request.Header.Set("X-Variant", variant)
+		web.ServeHTTP(httptest.NewRecorder(), request)
+	}
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	var lines []string
+	for _, line := range strings.Split(recorder.Body.String(), "\n") {
+		if strings.HasPrefix(line, "wf_requests_total{") && strings.Contains(line, "(+custom)") {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], " 1") || !strings.HasSuffix(lines[1], " 1") {
+		t.Errorf("want opaque routes counted apart, got %v", lines)
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if got := escapeLabel("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Errorf("got %s", got)
+	}
+}
@@ -0,0 +1,98 @@
+package wf
+
+import (
+	"net/http"
+	"slices"
+)
+
+// Middleware decorates the serving of a request matched by a [Handler],
+// which reads, parses, handles and responds as next.
+// It could respond by itself without invoking next, such as rejecting an unauthorized request.
+type Middleware func(next http.Handler) http.Handler
+
+// HaveMiddlewares is optional for a [Handler] to be served through middlewares,
+// whose first one is the outermost.
+type HaveMiddlewares interface {
+	Middlewares() []Middleware
+}
+
+// A decorating [Handler], which wraps another to change part of its behaviours,
+// shall implement Unwrap, so that optional interfaces of the wrapped one remain reachable.
+type unwrapper interface {
+	Unwrap() Handler
+}
+
+// handlerAs finds the first one in the chain of h and what it wraps that is T, like [errors.As].
+func handlerAs[T any](h Handler) (T, bool) {
+	for {
+		if t, ok := h.(T); ok {
+			return t, true
+		}
+		u, ok := h.(unwrapper)
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		h = u.Unwrap()
+	}
+}
+
+// collect returns every one in the chain of h and what it wraps that is T, the outer the earlier.
+func collect[T any](h Handler) []T {
+	var ret []T
+	for {
+		if t, ok := h.(T); ok {
+			ret = append(ret, t)
+		}
+		u, ok := h.(unwrapper)
+		if !ok {
+			return ret
+		}
+		h = u.Unwrap()
+	}
+}
+
+// collectMiddlewares returns middlewares of the chain of h, the outer wrapper's the outer.
+func collectMiddlewares(h Handler) []Middleware {
+	var ret []Middleware
+	for _, hm := range collect[HaveMiddlewares](h) {
+		ret = append(ret, hm.Middlewares()...)
+	}
+	return ret
+}
+
+// chain makes h served through middlewares, whose first one is the outermost.
+func chain(h http.Handler, middlewares []Middleware) http.Handler {
+	for _, m := range slices.Backward(middlewares) {
+		h = m(h)
+	}
+	return h
+}
+
+type middlewareHandler struct {
+	Handler
+	middlewares []Middleware
+}
+
+// WithMiddlewares makes h served through middlewares, inside the ones of [Web.Use].
+func WithMiddlewares(h Handler, middlewares ...Middleware) Handler {
+	return &middlewareHandler{Handler: h, middlewares: middlewares}
+}
+
+func (mh *middlewareHandler) Middlewares() []Middleware {
+	return mh.middlewares
+}
+
+func (mh *middlewareHandler) Unwrap() Handler {
+	return mh.Handler
+}
+
+func (mh *middlewareHandler) Describe() Route {
+	return describeHandler(mh.Handler)
+}
+
+// Use adds middlewares for every matched request, outside the ones of any [Handler].
+// Better to use before the start of serving, as it's not concurrency safe.
+func (w *Web) Use(middlewares ...Middleware) {
+	w.middlewares = append(w.middlewares, middlewares...)
+}
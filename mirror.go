@@ -0,0 +1,119 @@
+package wf
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// MirrorResult is what a primary or a shadow [CanHandle] returns for a request.
+type MirrorResult struct {
+	Output  HandleOutputType
+	Err     *CodedError
+	Latency time.Duration
+}
+
+// Mirror configures [WithMirror].
+type Mirror struct {
+	Shadow CanHandle
+	// Sampling is the ratio in [0, 1] of requests mirrored, zero as none, so that mirroring is opt-in.
+	Sampling float64
+	// Timeout bounds the shadow, zero as the global timeout from [SetTimeout].
+	Timeout time.Duration
+	// MaxInFlight bounds shadows running at the same time, beyond which requests are not mirrored, zero as 16.
+	MaxInFlight int
+	// Compare returns why the shadow diverges from the primary, nil as agreeing,
+	// such as to count divergences. Nil as comparing outputs by [reflect.DeepEqual] and error codes.
+	Compare func(ctx context.Context, req any, primary, shadow MirrorResult) error
+}
+
+type mirrorHandler struct {
+	Handler
+	config   Mirror
+	inFlight chan struct{}
+}
+
+// WithMirror makes a sampled copy of requests handled by the shadow in config, such as a rewrite of h,
+// after h handles them, whose output is compared to the one of h and logged on divergence.
+// The shadow runs asynchronously with its own timeout, and never changes or delays the response,
+// but it must not modify the parsed request, which is shared. Streams are not mirrored.
+func WithMirror(h Handler, config Mirror) Handler {
+	if config.Compare == nil {
+		config.Compare = compareMirror
+	}
+	return &mirrorHandler{Handler: h, config: config, inFlight: make(chan struct{}, cmp.Or(config.MaxInFlight, 16))}
+}
+
+func (mh *mirrorHandler) Unwrap() Handler {
+	return mh.Handler
+}
+
+func (mh *mirrorHandler) Describe() Route {
+	return describeHandler(mh.Handler)
+}
+
+func (mh *mirrorHandler) Handle(ctx context.Context, req any) (HandleOutputType, *CodedError) {
+	start := time.Now()
+	output, e := mh.Handler.Handle(ctx, req)
+	primary := MirrorResult{Output: output, Err: e, Latency: time.Since(start)}
+	if _, ok := output.(<-chan MessageEvent); ok {
+		return output, e
+	}
+	if rand.Float64() >= mh.config.Sampling {
+		return output, e
+	}
+	select {
+	case mh.inFlight <- struct{}{}:
+	default:
+		Logger(ctx).Debug("mirror skipped as too many in flight")
+		return output, e
+	}
+	go func() {
+		defer func() { <-mh.inFlight }()
+		mh.shadow(context.WithoutCancel(ctx), req, primary)
+	}()
+	return output, e
+}
+
+func (mh *mirrorHandler) shadow(ctx context.Context, req any, primary MirrorResult) {
+	logger := Logger(ctx)
+	defer func() {
+		if p := recover(); p != nil {
+			logger.Error("panic on mirror", "panic", p)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(ctx, cmp.Or(mh.config.Timeout, timeout))
+	defer cancel()
+	start := time.Now()
+	output, e := mh.config.Shadow.Handle(ctx, req)
+	shadow := MirrorResult{Output: output, Err: e, Latency: time.Since(start)}
+	if e == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		shadow.Err = NewCodedError(http.StatusGatewayTimeout, ctx.Err())
+	}
+	if err := mh.config.Compare(ctx, req, primary, shadow); err != nil {
+		logger.Warn("mirror diverged", "err", err, "latency", primary.Latency, "shadowLatency", shadow.Latency)
+	}
+}
+
+func compareMirror(_ context.Context, _ any, primary, shadow MirrorResult) error {
+	if code, shadowCode := codeOf(primary.Err), codeOf(shadow.Err); code != shadowCode {
+		return fmt.Errorf("code %d, shadow %d", code, shadowCode)
+	}
+	if primary.Err == nil && !reflect.DeepEqual(primary.Output, shadow.Output) {
+		return fmt.Errorf("output %v, shadow %v", primary.Output, shadow.Output)
+	}
+	return nil
+}
+
+// codeOf returns the code of e, 200 if nil.
+func codeOf(e *CodedError) int {
+	if e == nil {
+		return http.StatusOK
+	}
+	return e.Code
+}
@@ -0,0 +1,133 @@
+package wf
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithMirror(t *testing.T) {
+	double := func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		return *req.(*int) * 2, nil
+	}
+	candidate := NewJSONHandler(nil, nil, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		n := *req.(*int)
+		switch n {
+		case 3:
+			return 7, nil // the bug to find
+		case 4:
+			<-ctx.Done()
+		}
+		return n * 2, nil
+	})
+	type comparison struct {
+		req     int
+		primary MirrorResult
+		shadow  MirrorResult
+	}
+	compared := make(chan comparison, 1)
+	web := NewWeb(false, WithMirror(
+		NewJSONHandler(Exact(http.MethodPost, "/double"), reflect.TypeOf(0), double),
+		Mirror{
+			Shadow:   candidate,
+			Sampling: 1,
+			Timeout:  10 * time.Millisecond,
+			Compare: func(ctx context.Context, req any, primary, shadow MirrorResult) error {
+				compared <- comparison{*req.(*int), primary, shadow}
+				return nil
+			},
+		}))
+
+	tests := []struct {
+		req        string
+		shadow     any
+		shadowCode int
+	}{
+		{"2", 4, http.StatusOK},
+		{"3", 7, http.StatusOK},
+		{"4", 8, http.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		web.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/double", strings.NewReader(tt.req)))
+		c := <-compared
+		if c.shadow.Output != tt.shadow || codeOf(c.shadow.Err) != tt.shadowCode || c.primary.Output != c.req*2 {
+			t.Errorf("%s: unexpected comparison %+v", tt.req, c)
+		}
+		if want := strconv.Itoa(c.req * 2); recorder.Code != http.StatusOK || recorder.Body.String() != want {
+			t.Errorf("%s: want the primary response %s, got %d %q", tt.req, want, recorder.Code, recorder.Body)
+		}
+	}
+}
+
+func TestMirrorBounds(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	release := make(chan struct{})
+	shadowed := make(chan struct{}, 2)
+	shadow := NewJSONHandler(nil, nil, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		shadowed <- struct{}{}
+		<-release
+		return nil, nil
+	})
+	h := WithMirror(NewEchoHandler("/echo", 0, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		return req, nil
+	}), Mirror{Shadow: shadow, Sampling: 1, MaxInFlight: 1, Timeout: time.Minute})
+	for range 3 {
+		if _, e := h.Handle(context.Background(), []byte("x")); e != nil {
+			t.Fatal(e)
+		}
+	}
+	<-shadowed
+	close(release)
+	select {
+	case <-shadowed:
+		t.Error("want others skipped while one in flight")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestMirrorOptIn(t *testing.T) {
+	shadowed := make(chan struct{}, 1)
+	h := WithMirror(NewEchoHandler("/echo", 0, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		return req, nil
+	}), Mirror{Shadow: NewJSONHandler(nil, nil, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		shadowed <- struct{}{}
+		return nil, nil
+	})})
+	for range 10 {
+		if _, e := h.Handle(context.Background(), []byte("x")); e != nil {
+			t.Fatal(e)
+		}
+	}
+	select {
+	case <-shadowed:
+		t.Error("want nothing mirrored without Sampling")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestCompareMirror(t *testing.T) {
+	tests := []struct {
+		name            string
+		primary, shadow MirrorResult
+		diverged        bool
+	}{
+		{"same", MirrorResult{Output: []int{1}}, MirrorResult{Output: []int{1}}, false},
+		{"output", MirrorResult{Output: []int{1}}, MirrorResult{Output: []int{2}}, true},
+		{"code", MirrorResult{Output: 1}, MirrorResult{Err: NewCodedError(http.StatusNotFound, errors.New("gone"))}, true},
+		{"same code", MirrorResult{Err: NewCodedErrorf(http.StatusNotFound, "a")}, MirrorResult{Err: NewCodedErrorf(http.StatusNotFound, "b")}, false},
+	}
+	for _, tt := range tests {
+		if err := compareMirror(context.Background(), nil, tt.primary, tt.shadow); (err != nil) != tt.diverged {
+			t.Errorf("%s: want diverged %v, got %v", tt.name, tt.diverged, err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package wf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// MountedHandler adapts an [http.Handler], such as pprof or a legacy one, into a [Handler].
+// Once matched, [Web] serves the request with it rather than read, parse, handle and respond,
+// but still goes through CORS, middlewares, timeout and panic recovery.
+// Consider a longer [TimeoutConfig] for one that streams or profiles.
+type MountedHandler struct {
+	TimeoutConfig
+	matcher CanMatch
+	prefix  string // stripped before serving, empty as none
+	handler http.Handler
+}
+
+// Mount adapts handler to be served on requests that matcher accepts.
+func Mount(matcher CanMatch, handler http.Handler) *MountedHandler {
+	return &MountedHandler{matcher: matcher, handler: handler}
+}
+
+// MountPrefix adapts handler to be served on any request under prefix,
+// which would be stripped from URL.Path before serving if strip.
+func MountPrefix(prefix string, strip bool, handler http.Handler) *MountedHandler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	m := &MountedHandler{handler: handler}
+	m.matcher = PatternMatcher{func(req *http.Request) bool {
+		_, found := cutPathPrefix(req.URL.Path, prefix)
+		return found
+	}, Pattern{Path: prefix + anyRestPlaceholder}}
+	if strip {
+		m.prefix = prefix
+	}
+	return m
+}
+
+// MountFunc is a shortcut of [Mount] with an [http.HandlerFunc].
+func MountFunc(matcher CanMatch, handler http.HandlerFunc) *MountedHandler {
+	return Mount(matcher, handler)
+}
+
+func (m *MountedHandler) Match(req *http.Request) bool {
+	return m.matcher.Match(req)
+}
+
+func (m *MountedHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if m.prefix != "" {
+		rest, _ := cutPathPrefix(request.URL.Path, m.prefix)
+		request = withPath(request, rest)
+	}
+	m.handler.ServeHTTP(writer, request)
+}
+
+var errMountedNotServed = errors.New("mounted handler shall be served by Web through ServeHTTP")
+
+// Parse is not used, as [Web] serves the request through ServeHTTP.
+func (m *MountedHandler) Parse(_ []byte, _ string) (any, error) {
+	return nil, errMountedNotServed
+}
+
+// Handle is not used, as [Web] serves the request through ServeHTTP.
+func (m *MountedHandler) Handle(_ context.Context, _ any) (HandleOutputType, *CodedError) {
+	return nil, NewCodedError(http.StatusInternalServerError, errMountedNotServed)
+}
+
+// Response is not used, as [Web] serves the request through ServeHTTP.
+func (m *MountedHandler) Response(_ HandleOutputType, writer http.ResponseWriter) {
+	writer.WriteHeader(http.StatusInternalServerError)
+}
+
+func (m *MountedHandler) Describe() Route {
+	r := Route{
+		Pattern: DescribeMatch(m.matcher),
+		Handler: fmt.Sprintf("%T", m.handler),
+		Timeout: m.Timeout,
+	}
+	if hf, ok := m.handler.(http.HandlerFunc); ok {
+		r.Handler = funcName(hf)
+	}
+	return r
+}
+
+// pathRewriter is a decorating [Handler] that changes the path seen by what it wraps, such as a group.
+type pathRewriter interface {
+	rewritePath(req *http.Request) *http.Request
+}
+
+// serveHTTP serves request with the [http.Handler] in the chain of h, if any,
+// whose path is rewritten by decorators in between.
+func serveHTTP(h Handler, writer http.ResponseWriter, request *http.Request) bool {
+	for {
+		if hh, ok := h.(http.Handler); ok {
+			hh.ServeHTTP(writer, request)
+			return true
+		}
+		if pr, ok := h.(pathRewriter); ok {
+			request = pr.rewritePath(request)
+		}
+		u, ok := h.(unwrapper)
+		if !ok {
+			return false
+		}
+		h = u.Unwrap()
+	}
+}
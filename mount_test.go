@@ -0,0 +1,83 @@
+package wf
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMount(t *testing.T) {
+	legacy := http.NewServeMux()
+	legacy.HandleFunc("GET /hello", func(writer http.ResponseWriter, request *http.Request) {
+		if _, ok := writer.(http.Flusher); !ok {
+			t.Error("want writer remains a Flusher")
+		}
+		_, _ = writer.Write([]byte("hello " + request.Header.Get("X-Tag")))
+	})
+	api := NewGroup("/api").Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			request.Header.Set("X-Tag", "through middleware")
+			next.ServeHTTP(writer, request)
+		})
+	}).Handle(MountPrefix("/legacy/", true, legacy))
+	raw := MountFunc(Exact(http.MethodGet, "/raw"), func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusTeapot)
+	})
+	web := NewWeb(false, append(api.Handlers(), raw)...)
+
+	tests := []struct {
+		target string
+		status int
+		body   string
+	}{
+		{"/api/legacy/hello", http.StatusOK, "hello through middleware"},
+		{"/api/legacy/bye", http.StatusNotFound, "404 page not found\n"},
+		{"/api/legacyX/hello", http.StatusNotAcceptable, ""},
+		{"/raw", http.StatusTeapot, ""},
+	}
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		web.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if recorder.Code != tt.status {
+			t.Errorf("%s want status %d, got %d", tt.target, tt.status, recorder.Code)
+		}
+		if tt.body != "" && recorder.Body.String() != tt.body {
+			t.Errorf("%s want body %q, got %q", tt.target, tt.body, recorder.Body.String())
+		}
+	}
+
+	routes := web.Routes()
+	if got := routes[0].Pattern.String(); got != "/api/legacy/*" {
+		t.Errorf("want mounted pattern /api/legacy/*, got %s", got)
+	}
+	if got := routes[1].Handler; got != "wf.TestMount.func3" {
+		t.Errorf("want mounted handler named after func, got %s", got)
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	web := NewWeb(false,
+		MountFunc(Exact(http.MethodGet, "/before"), func(writer http.ResponseWriter, request *http.Request) {
+			panic("oops")
+		}),
+		MountFunc(Exact(http.MethodGet, "/after"), func(writer http.ResponseWriter, request *http.Request) {
+			writer.WriteHeader(http.StatusAccepted)
+			panic("oops")
+		}),
+	)
+
+	recorder := httptest.NewRecorder()
+	web.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/before", nil))
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("want status 500 on panic before writing, got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	web.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/after", nil))
+	if recorder.Code != http.StatusAccepted {
+		t.Errorf("want status kept on panic after writing, got %d", recorder.Code)
+	}
+}
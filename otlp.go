@@ -0,0 +1,126 @@
+package wf
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// OTLPJSONExporter exports spans as OTLP/JSON, one ExportTraceServiceRequest per span,
+// either as a line to a writer such as a file, or as a POST to a collector such as http://localhost:4318/v1/traces.
+type OTLPJSONExporter struct {
+	service  string
+	mu       sync.Mutex
+	writer   io.Writer
+	endpoint string
+	client   *http.Client
+}
+
+// NewOTLPJSONExporter writes spans of serviceName to writer in JSON Lines, which is what the file exporter of
+// OpenTelemetry Collector reads.
+func NewOTLPJSONExporter(writer io.Writer, serviceName string) *OTLPJSONExporter {
+	return &OTLPJSONExporter{service: serviceName, writer: writer}
+}
+
+// NewOTLPHTTPExporter posts spans of serviceName to endpoint, with http.DefaultClient if client is nil.
+func NewOTLPHTTPExporter(endpoint string, serviceName string, client *http.Client) *OTLPJSONExporter {
+	return &OTLPJSONExporter{service: serviceName, endpoint: endpoint, client: cmp.Or(client, http.DefaultClient)}
+}
+
+type otlpKeyValue struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	TraceState        string         `json:"traceState,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            map[string]any `json:"status,omitempty"`
+}
+
+// otlpValue converts v to an OTLP AnyValue, whose 64-bit integers are strings as protobuf JSON does.
+func otlpValue(v any) map[string]any {
+	switch v := v.(type) {
+	case string:
+		return map[string]any{"stringValue": v}
+	case bool:
+		return map[string]any{"boolValue": v}
+	case int:
+		return map[string]any{"intValue": strconv.Itoa(v)}
+	case int64:
+		return map[string]any{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		return map[string]any{"doubleValue": v}
+	default:
+		return map[string]any{"stringValue": fmt.Sprint(v)}
+	}
+}
+
+func (e *OTLPJSONExporter) marshal(span *SpanData) ([]byte, error) {
+	s := otlpSpan{
+		TraceID:           hex.EncodeToString(span.SpanContext.TraceID[:]),
+		SpanID:            hex.EncodeToString(span.SpanContext.SpanID[:]),
+		TraceState:        span.SpanContext.TraceState,
+		Name:              span.Name,
+		Kind:              span.Kind,
+		StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+	}
+	if span.Parent != [8]byte{} {
+		s.ParentSpanID = hex.EncodeToString(span.Parent[:])
+	}
+	for _, a := range span.Attributes {
+		s.Attributes = append(s.Attributes, otlpKeyValue{Key: a.Key, Value: otlpValue(a.Value)})
+	}
+	if span.Err != "" {
+		s.Status = map[string]any{"code": 2, "message": span.Err} // STATUS_CODE_ERROR
+	}
+	return json.Marshal(map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{
+				"attributes": []otlpKeyValue{{Key: "service.name", Value: otlpValue(e.service)}},
+			},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "github.com/hyisen/wf"},
+				"spans": []otlpSpan{s},
+			}},
+		}},
+	})
+}
+
+func (e *OTLPJSONExporter) ExportSpan(span *SpanData) error {
+	data, err := e.marshal(span)
+	if err != nil {
+		return err
+	}
+	if e.writer != nil {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		_, err := e.writer.Write(append(data, '\n'))
+		return err
+	}
+	rsp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer rsp.Body.Close()
+	_, _ = io.Copy(io.Discard, rsp.Body)
+	if rsp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %d from %s", rsp.StatusCode, e.endpoint)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package wf
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOTLPHTTPExporter(t *testing.T) {
+	var got string
+	collector := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		data, _ := io.ReadAll(request.Body)
+		got = string(data)
+		if request.URL.Path != "/v1/traces" {
+			writer.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer collector.Close()
+
+	span := &SpanData{
+		Name:       "handle",
+		Kind:       SpanKindInternal,
+		Start:      time.Unix(1, 0),
+		End:        time.Unix(2, 0),
+		Attributes: []SpanAttribute{{"wf.code", 500}, {"ok", false}},
+		Err:        "boom",
+	}
+	span.SpanContext.TraceID[0], span.SpanContext.SpanID[0] = 1, 2
+	if err := NewOTLPHTTPExporter(collector.URL+"/v1/traces", "svc", nil).ExportSpan(span); err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range []string{
+		`"stringValue":"svc"`,
+		`"traceId":"01000000000000000000000000000000"`,
+		`"spanId":"0200000000000000"`,
+		`"startTimeUnixNano":"1000000000"`,
+		`{"key":"wf.code","value":{"intValue":"500"}}`,
+		`{"key":"ok","value":{"boolValue":false}}`,
+		`"status":{"code":2,"message":"boom"}`,
+	} {
+		if !strings.Contains(got, part) {
+			t.Errorf("want %s in %s", part, got)
+		}
+	}
+
+	err := NewOTLPHTTPExporter(collector.URL+"/wrong", "svc", nil).ExportSpan(span)
+	if err == nil {
+		t.Errorf("want failure on 404, got %v", err)
+	}
+}
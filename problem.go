@@ -0,0 +1,27 @@
+package wf
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// Problem is the body of a response rejected by the framework rather than a [Handler],
+// such as on authentication or authorization failure. See RFC 9457.
+type Problem struct {
+	Type   string `json:"type,omitempty"` // empty as about:blank
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// RequestID is an extension to correlate with logs, see [DetachRequestID].
+	RequestID string `json:"requestId,omitempty"`
+}
+
+func writeProblem(writer http.ResponseWriter, request *http.Request, status int, detail string) {
+	id, _ := DetachRequestID(request.Context())
+	data, _ := json.Marshal(Problem{Title: http.StatusText(status), Status: status, Detail: detail, RequestID: id})
+	writer.Header().Set("Content-Type", ProblemContentType)
+	writer.WriteHeader(status)
+	_, _ = writer.Write(data)
+}
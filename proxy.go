@@ -0,0 +1,206 @@
+package wf
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HeaderRules changes headers passing through a [ProxyHandler], where Strip is applied before Add.
+type HeaderRules struct {
+	Strip []string
+	Add   http.Header
+}
+
+func (hr *HeaderRules) apply(header http.Header) {
+	for _, name := range hr.Strip {
+		header.Del(name)
+	}
+	for name, values := range hr.Add {
+		for _, value := range values {
+			header.Add(name, value)
+		}
+	}
+}
+
+// Upstream is a backend of [ProxyHandler], whose path is prepended to the path of requests,
+// and whose Timeout bounds a request to it, within the timeout of the ProxyHandler.
+type Upstream struct {
+	TimeoutConfig
+	URL string
+}
+
+// Proxy configures [NewProxyHandler].
+type Proxy struct {
+	Upstreams []Upstream // served by round robin
+	// Prefix is stripped from the path of requests, such as "/legacy" for "/legacy/items" to be "/items".
+	Prefix          string
+	RequestHeaders  HeaderRules
+	ResponseHeaders HeaderRules
+	// TrustForwarded keeps X-Forwarded-For of requests to append to, which is only right behind a trusted proxy.
+	// Otherwise, X-Forwarded-For, X-Forwarded-Host and X-Forwarded-Proto are set afresh.
+	TrustForwarded bool
+	// EjectAfter is how many consecutive failures, as errors or 502, 503 and 504, eject an upstream, zero as 3.
+	EjectAfter int
+	// EjectFor is how long an ejected upstream is skipped, zero as 30 seconds.
+	EjectFor  time.Duration
+	Transport http.RoundTripper // nil as [http.DefaultTransport]
+}
+
+type upstream struct {
+	Upstream
+	target *url.URL
+	proxy  *httputil.ReverseProxy
+
+	mu       sync.Mutex
+	failures int
+	ejected  time.Time // until
+}
+
+// ProxyHandler serves requests by a reverse proxy to upstreams, skipping ones that keep failing for a while,
+// or all of them are tried in turn if all are ejected.
+// A failure to reach an upstream is responded as a [CodedError] of 502, or 504 on timeout.
+type ProxyHandler struct {
+	*MountedHandler
+	config    Proxy
+	upstreams []*upstream
+
+	mu   sync.Mutex
+	next int
+}
+
+// NewProxyHandler creates a [ProxyHandler] on requests that matcher accepts, which panics on an invalid upstream URL.
+func NewProxyHandler(matcher CanMatch, config Proxy) *ProxyHandler {
+	if len(config.Upstreams) == 0 {
+		panic("proxy requires an upstream")
+	}
+	config.Prefix = strings.TrimSuffix(config.Prefix, "/")
+	ph := &ProxyHandler{config: config}
+	for _, u := range config.Upstreams {
+		target, err := url.Parse(u.URL)
+		if err != nil || target.Scheme == "" || target.Host == "" {
+			panic(fmt.Sprintf("invalid upstream %q", u.URL))
+		}
+		ph.upstreams = append(ph.upstreams, ph.newUpstream(u, target))
+	}
+	ph.MountedHandler = Mount(matcher, http.HandlerFunc(ph.serveProxy))
+	return ph
+}
+
+func (ph *ProxyHandler) newUpstream(u Upstream, target *url.URL) *upstream {
+	up := &upstream{Upstream: u, target: target}
+	up.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			if ph.config.TrustForwarded {
+				pr.Out.Header["X-Forwarded-For"] = pr.In.Header["X-Forwarded-For"]
+			}
+			pr.SetXForwarded()
+			pr.SetURL(target)
+			ctx := pr.In.Context()
+			if id, ok := DetachRequestID(ctx); ok {
+				pr.Out.Header.Set(RequestIDHeader, id)
+			}
+			if sc, ok := DetachSpanContext(ctx); ok && sc.IsValid() {
+				injectTrace(pr.Out.Header, sc)
+			}
+			ph.config.RequestHeaders.apply(pr.Out.Header)
+		},
+		Transport: ph.config.Transport,
+		ModifyResponse: func(rsp *http.Response) error {
+			switch rsp.StatusCode {
+			case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+				ph.failed(rsp.Request.Context(), up)
+			default:
+				up.succeeded()
+			}
+			ph.config.ResponseHeaders.apply(rsp.Header)
+			return nil
+		},
+		ErrorHandler: func(writer http.ResponseWriter, request *http.Request, err error) {
+			ctx := request.Context()
+			e := NewCodedError(http.StatusBadGateway, fmt.Errorf("upstream %s unavailable", target.Host))
+			// Rather than err, which could be the cause of the timeout from withTimeout.
+			switch {
+			case errors.Is(ctx.Err(), context.DeadlineExceeded):
+				e = NewCodedError(http.StatusGatewayTimeout, fmt.Errorf("upstream %s timeout", target.Host))
+				ph.failed(ctx, up)
+			case errors.Is(ctx.Err(), context.Canceled):
+				// The client is gone, which is not the upstream's fault.
+			default:
+				ph.failed(ctx, up)
+			}
+			Logger(ctx).Error("resp "+e.Error(), "err", err)
+			writer.WriteHeader(e.Code)
+			_, _ = writer.Write([]byte(e.Err.Error()))
+		},
+	}
+	return up
+}
+
+func (ph *ProxyHandler) serveProxy(writer http.ResponseWriter, request *http.Request) {
+	if ph.config.Prefix != "" {
+		rest, _ := cutPathPrefix(request.URL.Path, ph.config.Prefix)
+		request = withPath(request, rest)
+	}
+	up := ph.pick(Now(request.Context()))
+	ctx, cancel := withTimeout(request.Context(), up)
+	defer cancel()
+	up.proxy.ServeHTTP(writer, request.WithContext(ctx))
+}
+
+// pick returns the next upstream by round robin that's not ejected at now, or just the next if all are.
+func (ph *ProxyHandler) pick(now time.Time) *upstream {
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	start := ph.next
+	ph.next = (ph.next + 1) % len(ph.upstreams)
+	for i := range ph.upstreams {
+		up := ph.upstreams[(start+i)%len(ph.upstreams)]
+		if up.available(now) {
+			ph.next = (start + i + 1) % len(ph.upstreams)
+			return up
+		}
+	}
+	return ph.upstreams[start]
+}
+
+func (up *upstream) available(now time.Time) bool {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	return !now.Before(up.ejected)
+}
+
+func (up *upstream) succeeded() {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	up.failures = 0
+}
+
+func (ph *ProxyHandler) failed(ctx context.Context, up *upstream) {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	up.failures++
+	if up.failures >= cmp.Or(ph.config.EjectAfter, 3) {
+		up.failures = 0
+		ejectFor := cmp.Or(ph.config.EjectFor, 30*time.Second)
+		up.ejected = Now(ctx).Add(ejectFor)
+		Logger(ctx).Warn("upstream ejected", "upstream", up.URL, "for", ejectFor)
+	}
+}
+
+func (ph *ProxyHandler) Describe() Route {
+	r := ph.MountedHandler.Describe()
+	hosts := make([]string, len(ph.upstreams))
+	for i, up := range ph.upstreams {
+		hosts[i] = up.URL
+	}
+	r.Handler = "proxy: " + strings.Join(hosts, ", ")
+	return r
+}
@@ -0,0 +1,102 @@
+package wf
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProxyHandler(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	backend := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Server", "legacy")
+		writer.Header().Set("X-Backend", "a")
+		_, _ = fmt.Fprintf(writer, "%s %s|%s|%s|%s", request.Method, request.URL.Path,
+			request.Header.Get("X-Forwarded-For"), request.Header.Get("X-Api-Key"), request.Header.Get("Cookie"))
+	}))
+	defer backend.Close()
+	web := NewWeb(false, NewProxyHandler(Exact(http.MethodPost, "/legacy/items"), Proxy{
+		Upstreams:       []Upstream{{URL: backend.URL + "/api"}},
+		Prefix:          "/legacy",
+		RequestHeaders:  HeaderRules{Strip: []string{"Cookie"}, Add: http.Header{"X-Api-Key": {"k1"}}},
+		ResponseHeaders: HeaderRules{Strip: []string{"Server"}},
+		TrustForwarded:  true,
+	}))
+
+	request := httptest.NewRequest(http.MethodPost, "/legacy/items", strings.NewReader("{}"))
+	request.RemoteAddr = "10.0.0.2:1234"
+	request.Header.Set("X-Forwarded-For", "1.2.3.4")
+	request.Header.Set("Cookie", "session=s")
+	recorder := httptest.NewRecorder()
+	web.ServeHTTP(recorder, request)
+	if want := "POST /api/items|1.2.3.4, 10.0.0.2|k1|"; recorder.Body.String() != want {
+		t.Errorf("want %q, got %d %q", want, recorder.Code, recorder.Body)
+	}
+	if recorder.Header().Get("Server") != "" || recorder.Header().Get("X-Backend") != "a" {
+		t.Errorf("unexpected response headers %v", recorder.Header())
+	}
+}
+
+func TestProxyRoundRobinAndEjection(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	healthy := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = io.WriteString(writer, "healthy")
+	}))
+	defer healthy.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		<-request.Context().Done()
+	}))
+	defer slow.Close()
+	down := httptest.NewServer(nil)
+	down.Close()
+
+	tests := []struct {
+		name     string
+		upstream Upstream
+		status   int
+	}{
+		{"unavailable", Upstream{URL: failing.URL}, http.StatusServiceUnavailable},
+		{"timeout", Upstream{URL: slow.URL, TimeoutConfig: TimeoutConfig{Timeout: 10 * time.Millisecond}}, http.StatusGatewayTimeout},
+		{"refused", Upstream{URL: down.URL}, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(1_700_000_000, 0)
+			web := NewWeb(false, NewProxyHandler(Exact(http.MethodGet, "/p"), Proxy{
+				Upstreams:  []Upstream{{URL: healthy.URL}, tt.upstream},
+				EjectAfter: 2,
+				EjectFor:   time.Minute,
+			}))
+			server := withClock(web, &now)
+			get := func() (int, string) {
+				recorder := httptest.NewRecorder()
+				server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/p", nil))
+				return recorder.Code, recorder.Body.String()
+			}
+			var statuses []int
+			for range 6 {
+				code, _ := get()
+				statuses = append(statuses, code)
+			}
+			want := []int{http.StatusOK, tt.status, http.StatusOK, tt.status, http.StatusOK, http.StatusOK}
+			if fmt.Sprint(statuses) != fmt.Sprint(want) {
+				t.Errorf("want %v, got %v", want, statuses)
+			}
+			now = now.Add(time.Minute)
+			if code, _ := get(); code != tt.status {
+				t.Errorf("want back in rotation once expired, got %d", code)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package wf
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitAlgorithm decides whether a request is admitted from the [RateLimitState] of its key.
+type RateLimitAlgorithm int
+
+const (
+	// TokenBucket refills Limit tokens per Window evenly, which tolerates a burst up to Limit.
+	TokenBucket RateLimitAlgorithm = iota
+	// SlidingWindow admits Limit requests in any Window, estimated from the counts of the current and the previous
+	// fixed windows, which is smoother than a fixed window on its edges.
+	SlidingWindow
+)
+
+// RateLimitState is what a [RateLimitStore] keeps per key, which is plain data for a shared backend to persist.
+type RateLimitState struct {
+	Tokens float64   // left in the bucket of TokenBucket
+	Last   time.Time // of the last update, zero as a new state
+	// Count and Previous are of the current window starting at Window, and of the one before, for SlidingWindow.
+	Count    int
+	Previous int
+	Window   time.Time
+}
+
+// RateLimitStore keeps [RateLimitState] by key, see [NewMemoryRateLimitStore].
+// A shared backend, such as Redis, makes the limit hold across instances.
+type RateLimitStore interface {
+	// Update applies fn to the state of key atomically, which is a zero one if absent,
+	// and could be forgotten after ttl without update.
+	Update(ctx context.Context, key string, ttl time.Duration, fn func(state *RateLimitState)) error
+}
+
+// RateLimitKey tells which requests share a limit, such as [KeyByIP].
+type RateLimitKey func(req *http.Request) string
+
+// RateLimit configures [RateLimiter].
+type RateLimit struct {
+	Limit     int // requests per Window
+	Window    time.Duration
+	Algorithm RateLimitAlgorithm
+	Key       RateLimitKey   // nil as [KeyByIP] without proxy
+	Store     RateLimitStore // nil as a new in-memory one
+}
+
+// rateLimitDecision is the result of an update, in terms of the RateLimit headers.
+type rateLimitDecision struct {
+	allowed    bool
+	remaining  int
+	reset      time.Duration // until the limit is fully restored
+	retryAfter time.Duration // until the next request could be admitted, if not allowed
+}
+
+func (rl *RateLimit) decide(state *RateLimitState, now time.Time) rateLimitDecision {
+	limit := float64(rl.Limit)
+	if rl.Algorithm == SlidingWindow {
+		start := now.Truncate(rl.Window)
+		if !state.Window.Equal(start) {
+			if state.Window.Equal(start.Add(-rl.Window)) {
+				state.Previous = state.Count
+			} else {
+				state.Previous = 0
+			}
+			state.Count, state.Window = 0, start
+		}
+		elapsed := now.Sub(start)
+		weight := 1 - float64(elapsed)/float64(rl.Window)
+		estimated := float64(state.Previous)*weight + float64(state.Count)
+		d := rateLimitDecision{reset: rl.Window - elapsed}
+		if estimated+1 <= limit {
+			state.Count++
+			d.allowed = true
+			d.remaining = max(int(limit-estimated-1), 0)
+			return d
+		}
+		if state.Count+1 > rl.Limit || state.Previous == 0 {
+			d.retryAfter = rl.Window - elapsed
+		} else {
+			// When the weight of the previous window decays enough for one more.
+			wait := float64(rl.Window)*(1-(limit-float64(state.Count)-1)/float64(state.Previous)) - float64(elapsed)
+			d.retryAfter = time.Duration(max(wait, 0))
+		}
+		return d
+	}
+
+	perToken := rl.Window / time.Duration(rl.Limit)
+	if state.Last.IsZero() {
+		state.Tokens = limit
+	} else {
+		state.Tokens = math.Min(limit, state.Tokens+float64(now.Sub(state.Last))/float64(perToken))
+	}
+	state.Last = now
+	var d rateLimitDecision
+	if state.Tokens >= 1 {
+		state.Tokens--
+		d.allowed = true
+	} else {
+		d.retryAfter = time.Duration((1 - state.Tokens) * float64(perToken))
+	}
+	d.remaining = int(state.Tokens)
+	d.reset = time.Duration((limit - state.Tokens) * float64(perToken))
+	return d
+}
+
+// RateLimiter admits requests as rl, or rejects with 429 and Retry-After.
+// Every response has RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset.
+// Use it by [Web.Use] for all handlers, by [WithMiddlewares] or [Group.Use] for some routes,
+// and key by [KeyByRoute] to limit each route separately.
+// Failures of Store are logged and the request is admitted.
+func RateLimiter(rl RateLimit) Middleware {
+	if rl.Limit <= 0 || rl.Window <= 0 {
+		panic("rate limit requires a positive limit and window")
+	}
+	if rl.Key == nil {
+		rl.Key = KeyByIP("")
+	}
+	if rl.Store == nil {
+		rl.Store = NewMemoryRateLimitStore()
+	}
+	ttl := rl.Window
+	if rl.Algorithm == SlidingWindow {
+		ttl = 2 * rl.Window
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			request, byBatch := admittedByBatch(request, &rl)
+			if byBatch {
+				next.ServeHTTP(writer, request)
+				return
+			}
+			now := Now(request.Context())
+			var d rateLimitDecision
+			err := rl.Store.Update(request.Context(), rl.Key(request), ttl, func(state *RateLimitState) {
+				d = rl.decide(state, now)
+			})
+			if err != nil {
+				Logger(request.Context()).Error("unexpected failure on rate limit", "err", err)
+				next.ServeHTTP(writer, request)
+				return
+			}
+			header := writer.Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(rl.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(d.remaining))
+			header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.reset)))
+			if !d.allowed {
+				header.Set("Retry-After", strconv.Itoa(max(ceilSeconds(d.retryAfter), 1)))
+				Logger(request.Context()).Warn("rate limited", "method", request.Method, "url", request.URL)
+				writeProblem(writer, request, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// KeyByIP keys by the client IP, which is the last address in trustedHeader, such as X-Forwarded-For
+// appended by a trusted reverse proxy, or the remote address if trustedHeader is empty or absent.
+// Never trust a header that a client could set without a proxy in between.
+func KeyByIP(trustedHeader string) RateLimitKey {
+	return func(req *http.Request) string {
+		if trustedHeader != "" {
+			values := strings.Split(req.Header.Get(trustedHeader), ",")
+			if ip := strings.TrimSpace(values[len(values)-1]); ip != "" {
+				return "ip:" + ip
+			}
+		}
+		host, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			host = req.RemoteAddr
+		}
+		return "ip:" + host
+	}
+}
+
+// KeyByToken keys by the Token header, or Authorization if absent, hashed to keep secrets out of the store.
+// Requests without either share one key.
+func KeyByToken() RateLimitKey {
+	return func(req *http.Request) string {
+		token := req.Header.Get("Token")
+		if token == "" {
+			token = req.Header.Get("Authorization")
+		}
+		if token == "" {
+			return "token:"
+		}
+		sum := sha256.Sum256([]byte(token))
+		return "token:" + hex.EncodeToString(sum[:16])
+	}
+}
+
+// KeyByPrincipal keys by the subject of [Principal], where anonymous requests share one key.
+// It works as the [Authenticator] resolves before middlewares.
+func KeyByPrincipal() RateLimitKey {
+	return func(req *http.Request) string {
+		if p, ok := DetachPrincipal(req.Context()); ok {
+			return "principal:" + p.Subject
+		}
+		return "principal:"
+	}
+}
+
+// KeyByRoute keys by the route pattern, along with the handler name and [RouteID] for a custom matcher, see [DetachRoute].
+func KeyByRoute() RateLimitKey {
+	return func(req *http.Request) string {
+		r, _ := DetachRoute(req.Context())
+		return "route:" + r.Pattern.Method + " " + r.label()
+	}
+}
+
+// KeyBy combines keys, such as KeyBy(KeyByPrincipal(), KeyByRoute()) to limit each principal on each route.
+func KeyBy(keys ...RateLimitKey) RateLimitKey {
+	return func(req *http.Request) string {
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = k(req)
+		}
+		return strings.Join(parts, "|")
+	}
+}
+
+// MemoryRateLimitStore is a [RateLimitStore] in memory, which only limits within one instance.
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryRateLimitEntry
+	updates int
+}
+
+type memoryRateLimitEntry struct {
+	state   RateLimitState
+	expires time.Time
+}
+
+// sweepEvery is how many updates between removing expired entries.
+const sweepEvery = 1024
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{entries: map[string]*memoryRateLimitEntry{}}
+}
+
+func (s *MemoryRateLimitStore) Update(ctx context.Context, key string, ttl time.Duration, fn func(state *RateLimitState)) error {
+	now := Now(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updates++
+	if s.updates%sweepEvery == 0 {
+		for k, e := range s.entries {
+			if now.After(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+	}
+	e, ok := s.entries[key]
+	if !ok || now.After(e.expires) {
+		e = &memoryRateLimitEntry{}
+		s.entries[key] = e
+	}
+	fn(&e.state)
+	e.expires = now.Add(ttl)
+	return nil
+}
@@ -0,0 +1,115 @@
+package wf
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// withClock serves web with clock attached, as in [wftest].
+func withClock(web http.Handler, now *time.Time) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx := AttachClock(request.Context(), func() time.Time { return *now })
+		web.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
+
+func TestRateLimiter(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	ok := func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		return []byte("ok"), nil
+	}
+	type step struct {
+		advance    time.Duration
+		status     int
+		remaining  string
+		retryAfter string
+	}
+	tests := []struct {
+		name      string
+		algorithm RateLimitAlgorithm
+		limit     int
+		window    time.Duration
+		steps     []step
+	}{
+		{"token bucket", TokenBucket, 2, time.Second, []step{
+			{0, http.StatusOK, "1", ""},
+			{0, http.StatusOK, "0", ""},
+			{0, http.StatusTooManyRequests, "0", "1"},
+			{500 * time.Millisecond, http.StatusOK, "0", ""},
+			{2 * time.Second, http.StatusOK, "1", ""},
+		}},
+		{"sliding window", SlidingWindow, 2, time.Minute, []step{
+			{0, http.StatusOK, "1", ""},
+			{0, http.StatusOK, "0", ""},
+			{0, http.StatusTooManyRequests, "0", "60"},
+			{90 * time.Second, http.StatusOK, "0", ""},
+			{0, http.StatusTooManyRequests, "0", "30"},
+			{30 * time.Second, http.StatusOK, "0", ""},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			web := NewWeb(false, NewEchoHandler("/echo", 0, ok))
+			web.Use(RateLimiter(RateLimit{Limit: tt.limit, Window: tt.window, Algorithm: tt.algorithm}))
+			now := time.Unix(1_700_000_000, 0).Truncate(time.Minute)
+			server := withClock(web, &now)
+			for i, s := range tt.steps {
+				now = now.Add(s.advance)
+				recorder := httptest.NewRecorder()
+				server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/echo", nil))
+				header := recorder.Header()
+				if recorder.Code != s.status || header.Get("RateLimit-Remaining") != s.remaining ||
+					header.Get("Retry-After") != s.retryAfter || header.Get("RateLimit-Limit") != "2" {
+					t.Errorf("step %d: want %d remaining %s retry after %q, got %d %v",
+						i, s.status, s.remaining, s.retryAfter, recorder.Code, header)
+				}
+				if s.status == http.StatusTooManyRequests && header.Get("Content-Type") != ProblemContentType {
+					t.Errorf("step %d: want problem, got %q", i, recorder.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/items/3", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4, 5.6.7.8")
+	req.Header.Set("Token", "secret")
+	ctx := AttachPrincipal(req.Context(), &Principal{Subject: "alice"})
+	ctx = routeValue.Attach(ctx, Route{Pattern: Pattern{Method: http.MethodGet, Path: "/v1/items/{id}"}})
+	req = req.WithContext(ctx)
+
+	tests := []struct {
+		name string
+		key  RateLimitKey
+		want string
+	}{
+		{"ip", KeyByIP(""), "ip:10.0.0.1"},
+		{"proxy", KeyByIP("X-Forwarded-For"), "ip:5.6.7.8"},
+		{"absent proxy header", KeyByIP("X-Real-IP"), "ip:10.0.0.1"},
+		{"token", KeyByToken(), "token:2bb80d537b1da3e38bd30361aa855686"},
+		{"principal and route", KeyBy(KeyByPrincipal(), KeyByRoute()), "principal:alice|route:GET /v1/items/{id}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.key(req); got != tt.want {
+				t.Errorf("want %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	// Handlers built by one factory have the same name.
+	opaque := func(id RouteID) *http.Request {
+		ctx := routeValue.Attach(context.Background(), Route{ID: id, Pattern: Pattern{Opaque: true}, Handler: "api.variant.func1"})
+		return req.WithContext(ctx)
+	}
+	if a, b := KeyByRoute()(opaque(1)), KeyByRoute()(opaque(2)); a == b {
+		t.Errorf("want routes of custom matchers keyed apart, got %q for both", a)
+	}
+}
@@ -0,0 +1,149 @@
+package wf
+
+import (
+	"fmt"
+	"slices"
+)
+
+// routeTable is the handlers of a [Web] with their routes of the same index, which is never changed once stored,
+// so that a request sees a consistent one while routes change.
+type routeTable struct {
+	handlers []Handler
+	routes   []Route
+}
+
+// with returns a copy of t with h inserted at i as the route id.
+func (t *routeTable) with(i int, h Handler, id RouteID) *routeTable {
+	route := describeHandler(h)
+	route.ID = id
+	return &routeTable{
+		handlers: slices.Insert(slices.Clone(t.handlers), i, h),
+		routes:   slices.Insert(slices.Clone(t.routes), i, route),
+	}
+}
+
+// without returns a copy of t with the one at i removed.
+func (t *routeTable) without(i int) *routeTable {
+	return &routeTable{
+		handlers: slices.Delete(slices.Clone(t.handlers), i, i+1),
+		routes:   slices.Delete(slices.Clone(t.routes), i, i+1),
+	}
+}
+
+// index returns where the route id is, -1 if absent.
+func (t *routeTable) index(id RouteID) int {
+	return slices.IndexFunc(t.routes, func(r Route) bool {
+		return r.ID == id
+	})
+}
+
+// RouteID identifies a route of a [Web], which is assigned on registration, never reused, and kept by [Web.Replace].
+type RouteID uint64
+
+// RouteEventKind tells how the route table changes.
+type RouteEventKind int
+
+const (
+	RouteRegistered RouteEventKind = iota
+	RouteUnregistered
+	RouteReplaced
+)
+
+func (k RouteEventKind) String() string {
+	switch k {
+	case RouteRegistered:
+		return "registered"
+	case RouteUnregistered:
+		return "unregistered"
+	case RouteReplaced:
+		return "replaced"
+	}
+	return fmt.Sprintf("RouteEventKind(%d)", int(k))
+}
+
+// RouteEvent is a change of the route table of a [Web], see [Web.OnRouteChange].
+type RouteEvent struct {
+	Kind     RouteEventKind
+	Route    Route // registered, unregistered, or replacing
+	Previous Route // replaced, for RouteReplaced only
+}
+
+// OnRouteChange adds a listener of changes by [Web.Register], [Web.Unregister] and [Web.Replace],
+// which is called in the order of changes, and must not change routes itself.
+func (w *Web) OnRouteChange(listener func(RouteEvent)) {
+	w.tableMu.Lock()
+	defer w.tableMu.Unlock()
+	w.listeners = append(w.listeners, listener)
+}
+
+// Register adds h after the existing handlers on a running w, where requests being served are unaffected,
+// and returns its id to unregister or replace it by. Conflicts in the new route table are logged as [NewWeb] does.
+func (w *Web) Register(h Handler) RouteID {
+	w.tableMu.Lock()
+	defer w.tableMu.Unlock()
+	t := w.table.Load()
+	w.lastID++
+	t = t.with(len(t.handlers), w.bind(h), w.lastID)
+	w.table.Store(t)
+	w.emit(RouteEvent{Kind: RouteRegistered, Route: t.routes[len(t.routes)-1]})
+	w.logConflicts()
+	return w.lastID
+}
+
+// Unregister removes the route id, returning false if it's not registered.
+// Requests being served by its handler are unaffected.
+func (w *Web) Unregister(id RouteID) bool {
+	w.tableMu.Lock()
+	defer w.tableMu.Unlock()
+	t := w.table.Load()
+	i := t.index(id)
+	if i < 0 {
+		return false
+	}
+	w.table.Store(t.without(i))
+	w.emit(RouteEvent{Kind: RouteUnregistered, Route: t.routes[i]})
+	return true
+}
+
+// Replace swaps the handler of the route id with h in the same place of matching, keeping id,
+// returning false if it's not registered.
+func (w *Web) Replace(id RouteID, h Handler) bool {
+	w.tableMu.Lock()
+	defer w.tableMu.Unlock()
+	t := w.table.Load()
+	i := t.index(id)
+	if i < 0 {
+		return false
+	}
+	replaced := t.without(i).with(i, w.bind(h), id)
+	w.table.Store(replaced)
+	w.emit(RouteEvent{Kind: RouteReplaced, Route: replaced.routes[i], Previous: t.routes[i]})
+	w.logConflicts()
+	return true
+}
+
+// bind lets h know w if it needs to, see webAware.
+func (w *Web) bind(h Handler) Handler {
+	if wa, ok := handlerAs[webAware](h); ok {
+		wa.bindWeb(w)
+	}
+	return h
+}
+
+// emit informs listeners of e, which must be called with tableMu locked.
+func (w *Web) emit(e RouteEvent) {
+	w.log().Info("route "+e.Kind.String(), "method", e.Route.Pattern.Method, "route", e.Route.Pattern.String(), "handler", e.Route.Handler)
+	for _, listener := range w.listeners {
+		listener(e)
+	}
+}
+
+func (w *Web) logConflicts() {
+	for _, c := range w.Conflicts() {
+		if c.IsError() {
+			w.log().Error("route conflict", "err", c)
+		} else {
+			w.log().Warn("route conflict", "err", c)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package wf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRuntimeRegistration(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	reply := func(body string) HandleFunc {
+		return func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+			return []byte(body), nil
+		}
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	slow := NewEchoHandler("/plugin", 0, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		close(started)
+		<-release
+		return []byte("v1"), nil
+	})
+	web := NewWeb(false, NewEchoHandler("/core", 0, reply("core")))
+	var events []string
+	web.OnRouteChange(func(e RouteEvent) {
+		events = append(events, e.Kind.String()+" "+e.Route.Pattern.String())
+	})
+	get := func(target string) (int, string) {
+		recorder := httptest.NewRecorder()
+		web.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		return recorder.Code, recorder.Body.String()
+	}
+
+	if code, _ := get("/plugin"); code != http.StatusNotAcceptable {
+		t.Errorf("want unmatched before register, got %d", code)
+	}
+	id := web.Register(slow)
+	inFlight := make(chan string)
+	go func() {
+		_, body := get("/plugin")
+		inFlight <- body
+	}()
+	<-started
+
+	if !web.Replace(id, NewEchoHandler("/plugin", 0, reply("v2"))) {
+		t.Fatal("want replaced")
+	}
+	if _, body := get("/plugin"); body != "v2" {
+		t.Errorf("want the replacement served, got %q", body)
+	}
+	close(release)
+	if body := <-inFlight; body != "v1" {
+		t.Errorf("want the in-flight request unaffected, got %q", body)
+	}
+	if got := len(web.Routes()); got != 2 {
+		t.Errorf("want 2 routes, got %d", got)
+	}
+
+	if routes := web.Routes(); routes[1].ID != id {
+		t.Errorf("want the id kept on replace, got %+v", routes)
+	}
+	if !web.Unregister(id) {
+		t.Fatal("want unregistered")
+	}
+	if code, _ := get("/plugin"); code != http.StatusNotAcceptable {
+		t.Errorf("want unmatched once unregistered, got %d", code)
+	}
+	if web.Unregister(id) || web.Replace(id, slow) {
+		t.Error("want false on an unregistered id")
+	}
+	want := []string{"registered /plugin", "replaced /plugin", "unregistered /plugin"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("want events %v, got %v", want, events)
+	}
+	if routes := web.Routes(); len(routes) != 1 || routes[0].Pattern.Path != "/core" {
+		t.Errorf("unexpected routes %+v", routes)
+	}
+}
+
+func TestRuntimeRegistrationConcurrently(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	ok := func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		return []byte("ok"), nil
+	}
+	web := NewWeb(false, NewEchoHandler("/core", 0, ok))
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			web.Unregister(web.Register(NewEchoHandler(fmt.Sprintf("/p%d", i), 0, ok)))
+		}()
+		go func() {
+			defer wg.Done()
+			recorder := httptest.NewRecorder()
+			web.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/core", nil))
+			if recorder.Code != http.StatusOK {
+				t.Errorf("want core served, got %d", recorder.Code)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := len(web.Routes()); got != 1 {
+		t.Errorf("want only core left, got %d", got)
+	}
+}
+
+// uncomparable is a Handler that panics if compared by ==.
+type uncomparable struct {
+	Handler
+	tags []string
+}
+
+func TestRuntimeRegistrationUncomparable(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	ok := func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		return []byte("ok"), nil
+	}
+	web := NewWeb(false, uncomparable{Handler: NewEchoHandler("/a", 0, ok)})
+	id := web.Register(uncomparable{Handler: NewEchoHandler("/b", 0, ok)})
+	if !web.Replace(id, uncomparable{Handler: NewEchoHandler("/c", 0, ok)}) || !web.Unregister(id) {
+		t.Error("want replaced and unregistered by id")
+	}
+	if got := len(web.Routes()); got != 1 {
+		t.Errorf("want 1 route left, got %d", got)
+	}
+}
+
+func TestRegisterLogsConflictsToWebLogger(t *testing.T) {
+	ok := func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		return []byte("ok"), nil
+	}
+	web := NewWeb(false, NewEchoHandler("/a", 0, ok))
+	var buf bytes.Buffer
+	web.SetLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+	web.Register(NewEchoHandler("/a", 0, ok))
+	if !strings.Contains(buf.String(), "route conflict") {
+		t.Errorf("want the conflict logged to the logger of web, got %q", buf.String())
+	}
+}
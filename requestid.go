@@ -0,0 +1,102 @@
+package wf
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+)
+
+// RequestIDHeader is where [Web] accepts a request ID from the client, and echoes it in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds an accepted request ID, which is logged as is.
+const maxRequestIDLength = 128
+
+var (
+	requestIDValue = NewContextValue[string]("request id")
+	loggerValue    = NewContextValue[*slog.Logger]("logger")
+)
+
+func AttachRequestID(ctx context.Context, id string) context.Context {
+	return requestIDValue.Attach(ctx, id)
+}
+
+// DetachRequestID returns the ID of the request being served by [Web], false if none.
+func DetachRequestID(ctx context.Context) (string, bool) {
+	return requestIDValue.Detach(ctx)
+}
+
+// Logger returns the logger of the request being served by [Web], which logs its request ID,
+// or [slog.Default] if none.
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := loggerValue.Detach(ctx); ok && logger != nil {
+		return logger
+	}
+	return slog.Default()
+}
+
+// resolveRequestID accepts the X-Request-ID of req, or the trace ID of its traceparent, or generates one.
+func resolveRequestID(req *http.Request) string {
+	if id := req.Header.Get(RequestIDHeader); validRequestID(id) {
+		return id
+	}
+	if sc, ok := ParseTraceparent(req.Header.Get("traceparent"), ""); ok {
+		return hex.EncodeToString(sc.TraceID[:])
+	}
+	return newRequestID()
+}
+
+// validRequestID only accepts printable ASCII without space, as it's echoed in a header and logged.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// writerLogger returns the logger of the request that writer responds, through any wrapping middleware.
+func writerLogger(writer http.ResponseWriter) *slog.Logger {
+	if rw, ok := recordingWriter(writer); ok && rw.logger != nil {
+		return rw.logger
+	}
+	return slog.Default()
+}
+
+type requestIDTransport struct {
+	base http.RoundTripper
+}
+
+// PropagateRequestID makes outgoing requests through base carry the request ID in their context,
+// such as of the request being served, as X-Request-ID. A nil base is [http.DefaultTransport].
+//
+//	client := &http.Client{Transport: wf.PropagateRequestID(nil)}
+func PropagateRequestID(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &requestIDTransport{base: base}
+}
+
+func (t *requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id, ok := DetachRequestID(req.Context())
+	if !ok || req.Header.Get(RequestIDHeader) != "" {
+		return t.base.RoundTrip(req)
+	}
+	// A RoundTripper must not modify the request, see its doc.
+	req = req.Clone(req.Context())
+	req.Header.Set(RequestIDHeader, id)
+	return t.base.RoundTrip(req)
+}
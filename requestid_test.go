@@ -0,0 +1,90 @@
+package wf
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	var got string
+	web := NewWeb(false, NewEchoHandler("/id", 0, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		got, _ = DetachRequestID(ctx)
+		return []byte(got), nil
+	}))
+	tests := []struct {
+		name   string
+		header [2]string
+		want   string // empty as generated
+	}{
+		{"accepted", [2]string{RequestIDHeader, "abc-123"}, "abc-123"},
+		{"traceparent", [2]string{"traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}, "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"invalid traceparent", [2]string{"traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01"}, ""},
+		{"invalid", [2]string{RequestIDHeader, "a b"}, ""},
+		{"none", [2]string{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/id", nil)
+			if tt.header[0] != "" {
+				req.Header.Set(tt.header[0], tt.header[1])
+			}
+			recorder := httptest.NewRecorder()
+			web.ServeHTTP(recorder, req)
+			echoed := recorder.Header().Get(RequestIDHeader)
+			if echoed != got || recorder.Body.String() != got {
+				t.Errorf("want %q echoed, got header %q body %q", got, echoed, recorder.Body.String())
+			}
+			if tt.want != "" && got != tt.want {
+				t.Errorf("want %q, got %q", tt.want, got)
+			}
+			if tt.want == "" && len(got) != 32 {
+				t.Errorf("want generated, got %q", got)
+			}
+		})
+	}
+}
+
+func TestRequestIDInLogs(t *testing.T) {
+	var buf bytes.Buffer
+	old := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer slog.SetDefault(old)
+
+	web := NewWeb(false)
+	req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+	req.Header.Set(RequestIDHeader, "r42")
+	web.ServeHTTP(httptest.NewRecorder(), req)
+	if !strings.Contains(buf.String(), "requestID=r42") {
+		t.Errorf("want request ID in log %q", buf.String())
+	}
+}
+
+func TestPropagateRequestID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(request.Header.Get(RequestIDHeader)))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: PropagateRequestID(nil)}
+	ctx := AttachRequestID(context.Background(), "r7")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	rsp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer rsp.Body.Close()
+	var buf bytes.Buffer
+	_, _ = buf.ReadFrom(rsp.Body)
+	if buf.String() != "r7" {
+		t.Errorf("want r7 propagated, got %q", buf.String())
+	}
+	if req.Header.Get(RequestIDHeader) != "" {
+		t.Errorf("want the original request untouched")
+	}
+}
@@ -0,0 +1,357 @@
+package wf
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// idPlaceholder stands for a numeric path segment in [Pattern.Path].
+	idPlaceholder = "{id}"
+	// anyRestPlaceholder stands for any rest of the path at the end of [Pattern.Path], including none.
+	anyRestPlaceholder = "/*"
+)
+
+// Pattern is what a matcher accepts, recovered by [DescribeMatch].
+// Only a [HavePattern], such as matchers built by [Exact] and [ResourceWithID], could describe itself.
+type Pattern struct {
+	Method string   `json:"method,omitempty"` // empty as any method
+	Path   string   `json:"path,omitempty"`   // "{id}" as a numeric segment, "/*" suffix as any rest, empty as any path
+	Query  []string `json:"query,omitempty"`  // "key=value" required by [HasQuery]
+	// Opaque is true once any criterion is a custom matcher, or criteria require different methods or paths,
+	// whose accepted requests are unknown.
+	Opaque bool `json:"opaque,omitempty"`
+}
+
+func (p Pattern) String() string {
+	var sb strings.Builder
+	sb.WriteString(cmp.Or(p.Path, "*"))
+	if len(p.Query) > 0 {
+		sb.WriteString("?" + strings.Join(p.Query, "&"))
+	}
+	if p.Opaque {
+		sb.WriteString(" (+custom)")
+	}
+	return sb.String()
+}
+
+// HavePattern is a matcher that describes what it accepts, such as a [PatternMatcher].
+// A custom one could implement it too, so that its routes are validated as well.
+type HavePattern interface {
+	Pattern() Pattern
+}
+
+// PatternMatcher is a matcher built by this package, such as by [Exact] and [ResourceWithID],
+// which describes what it accepts.
+type PatternMatcher struct {
+	match   MatchFunc
+	pattern Pattern
+}
+
+func (m PatternMatcher) Match(req *http.Request) bool {
+	return m.match(req)
+}
+
+func (m PatternMatcher) Pattern() Pattern {
+	ret := m.pattern
+	ret.Query = slices.Clone(ret.Query)
+	return ret
+}
+
+// DescribeMatch recovers the [Pattern] of matcher, which is opaque unless it's a [HavePattern].
+// The matcher is never called, so that a custom one, even if composed of ones of this package, stays opaque.
+func DescribeMatch(matcher CanMatch) Pattern {
+	if hp, ok := matcher.(HavePattern); ok {
+		return hp.Pattern()
+	}
+	return Pattern{Opaque: true}
+}
+
+// Route is an entry of the route table of [Web].
+type Route struct {
+	ID          RouteID // see [Web.Register]
+	Pattern     Pattern
+	Handler     string        // name of the HandleFunc, or type of the Handler
+	Timeout     time.Duration // zero as the global one from [SetTimeout]
+	ContentType string
+	// Requirements are what a [Principal] must fulfil, see [Require].
+	Requirements []Requirement
+	Priority     Priority // see [WithPriority]
+}
+
+func (r Route) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID           RouteID       `json:"id,omitempty"`
+		Pattern      Pattern       `json:"pattern"`
+		Handler      string        `json:"handler"`
+		Timeout      string        `json:"timeout"`
+		ContentType  string        `json:"contentType,omitempty"`
+		Requirements []Requirement `json:"requirements,omitempty"`
+		Priority     string        `json:"priority,omitempty"`
+	}{r.ID, r.Pattern, r.Handler, r.effectiveTimeout().String(), r.ContentType, r.Requirements, r.priority()})
+}
+
+// priority is empty for the normal one, which is omitted in JSON.
+func (r Route) priority() string {
+	if r.Priority == PriorityNormal {
+		return ""
+	}
+	return r.Priority.String()
+}
+
+// label identifies r among routes, such as in metrics, by its pattern, along with its handler and [RouteID] if opaque,
+// as every custom matcher has the same pattern otherwise, and handlers built by one factory have the same name.
+func (r Route) label() string {
+	if r.Pattern.Opaque {
+		return r.Pattern.String() + " " + r.Handler + " #" + strconv.FormatUint(uint64(r.ID), 10)
+	}
+	return r.Pattern.String()
+}
+
+func (r Route) effectiveTimeout() time.Duration {
+	return cmp.Or(r.Timeout, timeout)
+}
+
+var routeValue = NewContextValue[Route]("route")
+
+// DetachRoute returns the route of the [Handler] that matches the request being served, false if none.
+func DetachRoute(ctx context.Context) (Route, bool) {
+	return routeValue.Detach(ctx)
+}
+
+// CanDescribe is optional for a [Handler] to fill its entry in the route table.
+// Without it, the entry is opaque and named after its type.
+type CanDescribe interface {
+	Describe() Route
+}
+
+func describeHandler(h Handler) Route {
+	if d, ok := h.(CanDescribe); ok {
+		return d.Describe()
+	}
+	r := Route{
+		Pattern: Pattern{Opaque: true},
+		Handler: fmt.Sprintf("%T", h),
+		Timeout: h.TimeoutOptional(),
+	}
+	if ct, ok := h.(HasResponseContentType); ok {
+		r.ContentType = ct.ResponseContentType()
+	}
+	return r
+}
+
+// funcName returns the name of f with package path trimmed, such as api.Handlers.func1.
+func funcName(f any) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer())
+	if fn == nil {
+		return "?"
+	}
+	name := fn.Name()
+	return name[strings.LastIndexByte(name, '/')+1:]
+}
+
+// ConflictKind tells how a route is affected by an earlier one.
+type ConflictKind int
+
+const (
+	// Duplicate is a route with the identical pattern as an earlier one, which is never reached.
+	Duplicate ConflictKind = iota
+	// Shadowed is a route whose every request is accepted by an earlier one, which is never reached.
+	Shadowed
+	// MayShadow is a route that is not reached on some requests, which is probably but not provably a bug.
+	MayShadow
+)
+
+func (k ConflictKind) String() string {
+	switch k {
+	case Duplicate:
+		return "duplicate"
+	case Shadowed:
+		return "shadowed"
+	case MayShadow:
+		return "may shadow"
+	}
+	return "ConflictKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// RouteConflict reports that route Index is affected by the earlier route By, both as index of handlers.
+type RouteConflict struct {
+	Kind  ConflictKind
+	Index int
+	By    int
+	Route Route
+	Prior Route
+}
+
+func (c RouteConflict) Error() string {
+	return fmt.Sprintf("route #%d %s %s (%s) is %s by route #%d %s %s (%s)",
+		c.Index, c.Route.Pattern.Method, c.Route.Pattern, c.Route.Handler, c.Kind,
+		c.By, c.Prior.Pattern.Method, c.Prior.Pattern, c.Prior.Handler)
+}
+
+// IsError tells whether the conflict is provable, rather than a warning.
+func (c RouteConflict) IsError() bool {
+	return c.Kind != MayShadow
+}
+
+// findConflicts checks every route with a known pattern, by a sample request it accepts,
+// whether any earlier handler would take it first.
+func findConflicts(handlers []Handler, routes []Route) []RouteConflict {
+	var ret []RouteConflict
+	for j, route := range routes {
+		sample := samplePatternRequest(route.Pattern)
+		if sample == nil {
+			continue
+		}
+		for i := range j {
+			if !handlers[i].Match(sample) {
+				continue
+			}
+			kind := MayShadow
+			if prior := routes[i].Pattern; !prior.Opaque {
+				if samePattern(prior, route.Pattern) {
+					kind = Duplicate
+				} else if coverPattern(prior, route.Pattern) {
+					kind = Shadowed
+				}
+			}
+			ret = append(ret, RouteConflict{Kind: kind, Index: j, By: i, Route: route, Prior: routes[i]})
+			break
+		}
+	}
+	return ret
+}
+
+// samplePatternRequest returns a request accepted by p, or nil if p is not known enough.
+func samplePatternRequest(p Pattern) *http.Request {
+	if p.Opaque || p.Path == "" {
+		return nil
+	}
+	target := strings.ReplaceAll(p.Path, idPlaceholder, "1")
+	if len(p.Query) > 0 {
+		target += "?" + strings.Join(p.Query, "&")
+	}
+	req, err := http.NewRequest(cmp.Or(p.Method, http.MethodGet), target, nil)
+	if err != nil {
+		return nil
+	}
+	return req
+}
+
+func samePattern(a Pattern, b Pattern) bool {
+	return a.Method == b.Method && a.Path == b.Path &&
+		slices.Equal(slices.Sorted(slices.Values(a.Query)), slices.Sorted(slices.Values(b.Query)))
+}
+
+// coverPattern tells whether every request accepted by b is accepted by a, where both are not opaque.
+func coverPattern(a Pattern, b Pattern) bool {
+	if a.Method != "" && a.Method != b.Method {
+		return false
+	}
+	for _, q := range a.Query {
+		if !slices.Contains(b.Query, q) {
+			return false
+		}
+	}
+	if a.Path == "" {
+		return true
+	}
+	if prefix, found := strings.CutSuffix(a.Path, anyRestPlaceholder); found {
+		_, found = cutPathPrefix(b.Path, prefix)
+		return found
+	}
+	as := strings.Split(strings.Trim(a.Path, "/"), "/")
+	bs := strings.Split(strings.Trim(b.Path, "/"), "/")
+	if len(as) != len(bs) {
+		return false
+	}
+	for i := range as {
+		if as[i] == bs[i] {
+			continue
+		}
+		if as[i] != idPlaceholder {
+			return false
+		}
+		if _, err := strconv.Atoi(bs[i]); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Routes returns the route table, in the order of matching.
+func (w *Web) Routes() []Route {
+	return slices.Clone(w.table.Load().routes)
+}
+
+// Conflicts returns the duplicated and shadowed routes found in the route table.
+func (w *Web) Conflicts() []RouteConflict {
+	t := w.table.Load()
+	return findConflicts(t.handlers, t.routes)
+}
+
+// Validate returns the provable conflicts in the route table, such as duplicated or shadowed routes.
+// [NewWeb] only logs them, use Validate to fail fast on startup or in tests.
+func (w *Web) Validate() error {
+	var errs []error
+	for _, c := range w.Conflicts() {
+		if c.IsError() {
+			errs = append(errs, c)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PrintRoutes writes the route table as an aligned text table.
+func (w *Web) PrintRoutes(writer io.Writer) error {
+	tw := tabwriter.NewWriter(writer, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "#\tMETHOD\tPATTERN\tHANDLER\tTIMEOUT\tCONTENT-TYPE\tREQUIRES")
+	for i, r := range w.table.Load().routes {
+		var requires []string
+		for _, requirement := range r.Requirements {
+			requires = append(requires, requirement.String())
+		}
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%v\t%s\t%s\n",
+			i, cmp.Or(r.Pattern.Method, "*"), r.Pattern, r.Handler, r.effectiveTimeout(), r.ContentType, strings.Join(requires, " "))
+	}
+	return tw.Flush()
+}
+
+// webAware is implemented by a [Handler] which needs the [Web] it's registered in.
+type webAware interface {
+	bindWeb(w *Web)
+}
+
+// RoutesHandler is a debug endpoint that responds the route table of the [Web] it's registered in.
+type RoutesHandler struct {
+	*ClosureHandler
+	web *Web
+}
+
+func NewRoutesHandler(matcher CanMatch) *RoutesHandler {
+	rh := &RoutesHandler{}
+	rh.ClosureHandler = NewJSONHandler(matcher, reflect.TypeOf(Empty{}),
+		func(_ context.Context, _ any) (rsp any, codedError *CodedError) {
+			if rh.web == nil {
+				return nil, NewCodedErrorf(http.StatusInternalServerError, "routes handler not registered")
+			}
+			return rh.web.Routes(), nil
+		})
+	return rh
+}
+
+func (rh *RoutesHandler) bindWeb(w *Web) {
+	rh.web = w
+}
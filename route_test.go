@@ -0,0 +1,145 @@
+package wf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDescribeMatch(t *testing.T) {
+	mf, _ := ResourceWithIDs(http.MethodGet, []string{"users", "", "items", ""})
+	tests := []struct {
+		name    string
+		matcher CanMatch
+		want    Pattern
+	}{
+		{"exact", Exact(http.MethodGet, "/v1/ask"), Pattern{Method: http.MethodGet, Path: "/v1/ask"}},
+		{"with id", ResourceWithID(http.MethodPost, "/v1/items/", "/content"), Pattern{Method: http.MethodPost, Path: "/v1/items/{id}/content"}},
+		{"with ids", mf, Pattern{Method: http.MethodGet, Path: "/users/{id}/items/{id}"}},
+		{"all", MatchAll(Exact(http.MethodGet, "/v1/ask"), HasQuery("q", "x")), Pattern{Method: http.MethodGet, Path: "/v1/ask", Query: []string{"q=x"}}},
+		{"custom", MatchFunc(func(req *http.Request) bool { return req.URL.Path == "/x" }), Pattern{Opaque: true}},
+		{"all with custom", MatchAll(Exact(http.MethodGet, "/v1/ask"), MatchFunc(func(req *http.Request) bool {
+			return req.Header.Get("X") != ""
+		})), Pattern{Method: http.MethodGet, Path: "/v1/ask", Opaque: true}},
+		{"panic custom", MatchFunc(func(req *http.Request) bool { return req.TLS.ServerName == "" }), Pattern{Opaque: true}},
+		{"all with another method", MatchAll(Exact(http.MethodGet, "/a"), Exact(http.MethodPost, "/a")), Pattern{Method: http.MethodGet, Path: "/a", Opaque: true}},
+		{"all with another path", MatchAll(Exact(http.MethodGet, "/a"), ResourceWithID(http.MethodGet, "/a/", "")), Pattern{Method: http.MethodGet, Path: "/a", Opaque: true}},
+		{"all with the same path", MatchAll(Exact(http.MethodGet, "/a"), Exact(http.MethodGet, "/a")), Pattern{Method: http.MethodGet, Path: "/a"}},
+		{"not", not(Exact(http.MethodGet, "/a")), Pattern{Opaque: true}},
+		{"any", anyOf(Exact(http.MethodGet, "/a"), Exact(http.MethodGet, "/b")), Pattern{Opaque: true}},
+		{"all with any", MatchAll(HasQuery("q", "x"), anyOf(Exact(http.MethodGet, "/a"))), Pattern{Query: []string{"q=x"}, Opaque: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DescribeMatch(tt.matcher); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func not(matcher CanMatch) MatchFunc {
+	return func(req *http.Request) bool {
+		return !matcher.Match(req)
+	}
+}
+
+func anyOf(matchers ...CanMatch) MatchFunc {
+	return func(req *http.Request) bool {
+		return slices.ContainsFunc(matchers, func(m CanMatch) bool { return m.Match(req) })
+	}
+}
+
+func TestValidateCustomCompositions(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	web := NewWeb(false,
+		newEmptyHandler(anyOf(Exact(http.MethodGet, "/a"), Exact(http.MethodGet, "/b"))),
+		newEmptyHandler(MatchAll(Exact(http.MethodGet, "/a"), HasQuery("v", "2"))),
+		newEmptyHandler(not(Exact(http.MethodGet, "/a"))),
+		newEmptyHandler(Exact(http.MethodGet, "/a")),
+	)
+	if err := web.Validate(); err != nil {
+		t.Errorf("want no provable conflict, got %v", err)
+	}
+	for _, c := range web.Conflicts() {
+		if c.Index != 1 && c.Index != 3 || c.By != 0 || c.Kind != MayShadow {
+			t.Errorf("unexpected conflict %v", c)
+		}
+	}
+}
+
+func newEmptyHandler(matcher CanMatch) Handler {
+	return NewClosureHandler(matcher, ParseEmpty, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		return nil, nil
+	}, FormatEmpty, "text/plain")
+}
+
+func TestConflicts(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	web := NewWeb(false,
+		newEmptyHandler(ResourceWithID(http.MethodGet, "/v1/items/", "")),
+		newEmptyHandler(Exact(http.MethodGet, "/v1/items/42")),
+		newEmptyHandler(Exact(http.MethodGet, "/v1/items")),
+		newEmptyHandler(Exact(http.MethodGet, "/v1/items")),
+		newEmptyHandler(MatchFunc(func(req *http.Request) bool { return strings.HasPrefix(req.URL.Path, "/v2/") })),
+		newEmptyHandler(Exact(http.MethodGet, "/v2/items")),
+		newEmptyHandler(Exact(http.MethodPost, "/v1/items")),
+	)
+	var got []ConflictKind
+	for _, c := range web.Conflicts() {
+		got = append(got, c.Kind)
+	}
+	if want := []ConflictKind{Shadowed, Duplicate, MayShadow}; !slices.Equal(got, want) {
+		t.Errorf("want conflicts %v, got %v", want, got)
+	}
+
+	err := web.Validate()
+	var c RouteConflict
+	if !errors.As(err, &c) || c.Index != 1 || c.By != 0 {
+		t.Errorf("want the first error on route #1 by #0, got %v", err)
+	}
+
+	if err := NewWeb(false, newEmptyHandler(Exact(http.MethodGet, "/a"))).Validate(); err != nil {
+		t.Errorf("want no error, got %v", err)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	h := NewEchoHandler("/echo", 0, func(_ context.Context, req any) (rsp any, codedError *CodedError) {
+		return req, nil
+	})
+	rh := NewRoutesHandler(Exact(http.MethodGet, "/debug/routes"))
+	web := NewWeb(false, h, rh)
+
+	var sb strings.Builder
+	if err := web.PrintRoutes(&sb); err != nil {
+		t.Fatal(err)
+	}
+	for _, keyword := range []string{"/echo", "/debug/routes", "wf.TestRoutes.func1", "text/plain", timeout.String()} {
+		if !strings.Contains(sb.String(), keyword) {
+			t.Errorf("want keyword %q in table\n%s", keyword, sb.String())
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	web.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/routes", nil))
+	var routes []struct {
+		Pattern Pattern `json:"pattern"`
+		Handler string  `json:"handler"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &routes); err != nil {
+		t.Fatalf("unmarshal %q: %v", recorder.Body.String(), err)
+	}
+	if len(routes) != 2 || routes[1].Pattern.Path != "/debug/routes" {
+		t.Errorf("unexpected routes %+v", routes)
+	}
+}
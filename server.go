@@ -0,0 +1,180 @@
+package wf
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Server runs a [Web] with graceful shutdown, rather than [http.ListenAndServe] that kills requests on exit.
+//
+// On SIGTERM, SIGINT or the cancellation of its context, it flips [Web.Ready] to false, keeps serving for
+// DrainDelay, sends FinalEvent to every Server-Sent Events stream and closes it, waits for in-flight requests
+// up to DrainTimeout, and runs the stop hooks.
+type Server struct {
+	HTTPServer *http.Server
+	web        *Web
+	// DrainDelay is how long to keep serving after turning unready, so that load balancers stop sending first.
+	DrainDelay time.Duration
+	// DrainTimeout bounds the wait for in-flight requests and the stop hooks, zero as 30 seconds.
+	DrainTimeout time.Duration
+	// FinalEvent is sent to every open stream on shutdown, nil as closing them without one.
+	FinalEvent *MessageEvent
+
+	mu      sync.Mutex
+	onStart []func(ctx context.Context) error
+	onStop  []func(ctx context.Context) error
+}
+
+func NewServer(addr string, web *Web) *Server {
+	return &Server{
+		HTTPServer: &http.Server{Addr: addr, Handler: web},
+		web:        web,
+	}
+}
+
+// OnStart adds a hook run before serving, such as opening a database, which aborts the start on error
+// with the stop hooks run.
+func (s *Server) OnStart(hook func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onStart = append(s.onStart, hook)
+}
+
+// OnStop adds a hook run after draining, in the reverse order of adding, such as closing a database.
+func (s *Server) OnStop(hook func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onStop = append(s.onStop, hook)
+}
+
+// ListenAndServe listens on the address of HTTPServer and serves until shutdown, see [Server.Serve].
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	ln, err := net.Listen("tcp", cmp.Or(s.HTTPServer.Addr, ":http"))
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve runs the start hooks, then serves on ln until ctx is done or a SIGTERM or SIGINT is received,
+// and shuts down gracefully. It returns nil after a graceful shutdown.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	s.mu.Lock()
+	onStart := slices.Clone(s.onStart)
+	s.mu.Unlock()
+	for _, hook := range onStart {
+		if err := hook(ctx); err != nil {
+			_ = ln.Close()
+			return errors.Join(err, s.stop())
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	served := make(chan error, 1)
+	go func() {
+		served <- s.HTTPServer.Serve(ln)
+	}()
+	select {
+	case err := <-served:
+		return errors.Join(err, s.stop())
+	case <-ctx.Done():
+	}
+	s.web.log().Info("shutting down", "cause", context.Cause(ctx))
+
+	// Streams are closed only once load balancers stop routing here, or their clients reconnect to this one.
+	s.web.unready()
+	time.Sleep(s.DrainDelay)
+	s.web.closeStreams(s.FinalEvent)
+	err := s.stop()
+	if serveErr := <-served; !errors.Is(serveErr, http.ErrServerClosed) {
+		err = errors.Join(serveErr, err)
+	}
+	return err
+}
+
+// stop shuts HTTPServer down and runs the stop hooks, all within DrainTimeout.
+func (s *Server) stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), cmp.Or(s.DrainTimeout, 30*time.Second))
+	defer cancel()
+	err := s.HTTPServer.Shutdown(ctx)
+	s.mu.Lock()
+	onStop := slices.Clone(s.onStop)
+	s.mu.Unlock()
+	for _, hook := range slices.Backward(onStop) {
+		err = errors.Join(err, hook(ctx))
+	}
+	return err
+}
+
+// Ready tells whether w accepts new work, false once a [Server] starts draining it.
+func (w *Web) Ready() bool {
+	select {
+	case <-w.draining:
+		return false
+	default:
+		return true
+	}
+}
+
+// drain turns w unready, and closes Server-Sent Events streams with final sent if not nil.
+func (w *Web) drain(final *MessageEvent) {
+	w.unready()
+	w.closeStreams(final)
+}
+
+// unready flips [Web.Ready] to false.
+func (w *Web) unready() {
+	w.drainOnce.Do(func() {
+		close(w.draining)
+	})
+}
+
+// closeStreams closes Server-Sent Events streams with final sent if not nil.
+func (w *Web) closeStreams(final *MessageEvent) {
+	w.closeOnce.Do(func() {
+		w.finalEvent = final
+		close(w.closing)
+	})
+}
+
+// drainable forwards events of ch until it's closed, ctx is done, or streams of w are closed with the final event sent.
+func (w *Web) drainable(ctx context.Context, ch <-chan MessageEvent) <-chan MessageEvent {
+	out := make(chan MessageEvent)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case me, ok := <-ch:
+				if !ok {
+					return
+				}
+				select {
+				case out <- me:
+				case <-ctx.Done():
+					return
+				}
+			case <-w.closing:
+				if w.finalEvent != nil {
+					select {
+					case out <- *w.finalEvent:
+					case <-ctx.Done():
+					}
+				}
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
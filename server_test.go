@@ -0,0 +1,147 @@
+package wf
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerGracefulShutdown(t *testing.T) {
+	old := slog.SetLogLoggerLevel(LevelNever)
+	defer slog.SetLogLoggerLevel(old)
+	slowStarted := make(chan struct{})
+	events := NewServerSentEventsHandler(Exact(http.MethodGet, "/events"), ParseEmpty,
+		func(ctx context.Context, req any) (<-chan MessageEvent, *CodedError) {
+			ch := make(chan MessageEvent, 1)
+			ch <- MessageEvent{Lines: []string{"hello"}}
+			return ch, nil // never closed by itself
+		})
+	events.Timeout = time.Minute
+	web := NewWeb(false,
+		events,
+		NewReadinessHandler(Exact(http.MethodGet, "/readyz")),
+		NewEchoHandler("/slow", time.Second, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+			close(slowStarted)
+			time.Sleep(100 * time.Millisecond)
+			return []byte("done"), nil
+		}),
+	)
+	server := NewServer("", web)
+	server.DrainDelay = 50 * time.Millisecond
+	server.FinalEvent = &MessageEvent{TypeOptional: "shutdown", Lines: []string{"bye"}}
+	var hooks []string
+	server.OnStart(func(ctx context.Context) error {
+		hooks = append(hooks, "start")
+		return nil
+	})
+	server.OnStop(func(ctx context.Context) error {
+		hooks = append(hooks, "stop db")
+		return nil
+	})
+	server.OnStop(func(ctx context.Context) error {
+		hooks = append(hooks, "stop cache")
+		return nil
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := "http://" + ln.Addr().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() {
+		served <- server.Serve(ctx, ln)
+	}()
+
+	if rsp, err := http.Get(base + "/readyz"); err != nil || rsp.StatusCode != http.StatusOK {
+		t.Fatalf("want ready, got %v %v", rsp, err)
+	}
+	stream, err := http.Get(base + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer stream.Body.Close()
+	reader := bufio.NewReader(stream.Body)
+	if line, _ := reader.ReadString('\n'); line != "data: hello\n" {
+		t.Fatalf("unexpected first line %q", line)
+	}
+	slow := make(chan string)
+	go func() {
+		rsp, err := http.Get(base + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		data, _ := io.ReadAll(rsp.Body)
+		_ = rsp.Body.Close()
+		slow <- string(data)
+	}()
+	<-slowStarted
+
+	closed := make(chan []byte)
+	go func() {
+		rest, _ := io.ReadAll(reader)
+		closed <- rest
+	}()
+	cancel()
+	for web.Ready() {
+		time.Sleep(time.Millisecond)
+	}
+	if rsp, err := http.Get(base + "/readyz"); err != nil || rsp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("want unready while delaying, got %v %v", rsp, err)
+	}
+	var rest []byte
+	select {
+	case rest = <-closed:
+		t.Error("want streams kept open until load balancers stop routing")
+	default:
+		rest = <-closed
+	}
+	if !strings.Contains(string(rest), "event: shutdown\ndata: bye\n") {
+		t.Errorf("want final event, got %q", rest)
+	}
+	if web.Ready() {
+		t.Error("want unready once draining")
+	}
+	if got := <-slow; got != "done" {
+		t.Errorf("want in-flight request drained, got %q", got)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("want graceful, got %v", err)
+	}
+	if want := []string{"start", "stop cache", "stop db"}; !reflect.DeepEqual(hooks, want) {
+		t.Errorf("want hooks %v, got %v", want, hooks)
+	}
+}
+
+func TestServerStartFailure(t *testing.T) {
+	server := NewServer("", NewWeb(false))
+	stopped := false
+	server.OnStart(func(ctx context.Context) error {
+		return errors.New("no database")
+	})
+	server.OnStop(func(ctx context.Context) error {
+		stopped = true
+		return nil
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Serve(context.Background(), ln); err == nil || !strings.Contains(err.Error(), "no database") {
+		t.Errorf("want start failure, got %v", err)
+	}
+	if !stopped {
+		t.Error("want stop hooks run on start failure")
+	}
+}
@@ -0,0 +1,220 @@
+package wf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// StaticHandler serves files from an [fs.FS], such as [embed.FS] or [os.DirFS], under a path prefix.
+//
+// It's built on [http.ServeContent], which supports Range, If-Modified-Since and If-None-Match.
+// As files in [embed.FS] have no modification time, a content hash is used as their ETag.
+//
+// If the client accepts, a precompressed sibling such as app.js.br or app.js.gz is served instead of app.js.
+// A file whose name contains a content hash, such as app.3f2a9c1b.js, is cached as immutable,
+// while others are revalidated on every use.
+type StaticHandler struct {
+	*MountedHandler
+	fsys fs.FS
+	// SPA makes a GET on a missing path without extension served with the root index.html,
+	// which is the way a single-page app handles its own routes.
+	SPA   bool
+	etags sync.Map // served name to ETag, only for files without modification time
+}
+
+// NewStaticHandler serves fsys under prefix, whose request path /prefix/a/b.js is file a/b.js in fsys.
+// Use [fs.Sub] if the files are in a subdirectory of fsys, which is common for [embed.FS].
+func NewStaticHandler(prefix string, fsys fs.FS) *StaticHandler {
+	sh := &StaticHandler{fsys: fsys}
+	sh.MountedHandler = MountPrefix(prefix, true, http.HandlerFunc(sh.serveFile))
+	return sh
+}
+
+func (sh *StaticHandler) Match(req *http.Request) bool {
+	return (req.Method == http.MethodGet || req.Method == http.MethodHead) && sh.MountedHandler.Match(req)
+}
+
+func (sh *StaticHandler) Describe() Route {
+	r := sh.MountedHandler.Describe()
+	r.Pattern.Method = http.MethodGet
+	r.Handler = fmt.Sprintf("static %T", sh.fsys)
+	return r
+}
+
+// immutablePattern finds a content hash of at least 8 hex digits as a part of the file name.
+var immutablePattern = regexp.MustCompile(`[.-][0-9a-fA-F]{8,}\.`)
+
+// precompressed is in the order of preference.
+var precompressed = []struct {
+	encoding  string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+func (sh *StaticHandler) serveFile(writer http.ResponseWriter, request *http.Request) {
+	if containsDotDot(request.URL.Path) {
+		http.Error(writer, "invalid path", http.StatusBadRequest)
+		return
+	}
+	requested := strings.TrimPrefix(path.Clean("/"+request.URL.Path), "/")
+	name, info, err := sh.resolve(requested)
+	// By the requested path, as resolve turns a directory into its index.html.
+	if errors.Is(err, fs.ErrNotExist) && sh.SPA && path.Ext(requested) == "" {
+		name, info, err = sh.resolve("index.html")
+	}
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(writer, request)
+			return
+		}
+		Logger(request.Context()).Error("unexpected failure on stat", "err", err, "name", name)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	header := writer.Header()
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		// Set before choosing a precompressed sibling, whose extension is .gz or .br.
+		header.Set("Content-Type", ct)
+	}
+	if immutablePattern.MatchString(path.Base(name)) {
+		header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		header.Set("Cache-Control", "no-cache")
+	}
+	header.Add("Vary", "Accept-Encoding")
+	served := name
+	accept := request.Header.Get("Accept-Encoding")
+	for _, p := range precompressed {
+		if !acceptsEncoding(accept, p.encoding) {
+			continue
+		}
+		if ci, err := fs.Stat(sh.fsys, name+p.extension); err == nil && ci.Mode().IsRegular() {
+			header.Set("Content-Encoding", p.encoding)
+			if header.Get("Content-Type") == "" {
+				// Or ServeContent would sniff the compressed content.
+				header.Set("Content-Type", "application/octet-stream")
+			}
+			served, info = name+p.extension, ci
+			break
+		}
+	}
+
+	content, err := sh.open(served)
+	if err != nil {
+		Logger(request.Context()).Error("unexpected failure on open", "err", err, "name", served)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if closer, ok := content.(io.Closer); ok {
+		//goland:noinspection GoUnhandledErrorResult
+		defer closer.Close()
+	}
+	if info.ModTime().IsZero() {
+		etag, err := sh.etag(served, content)
+		if err != nil {
+			Logger(request.Context()).Error("unexpected failure on hash", "err", err, "name", served)
+			writer.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		header.Set("ETag", etag)
+	}
+	http.ServeContent(writer, request, name, info.ModTime(), content)
+}
+
+// resolve finds the regular file of name, which is index.html inside if name is a directory.
+func (sh *StaticHandler) resolve(name string) (string, fs.FileInfo, error) {
+	if name == "" {
+		name = "."
+	}
+	info, err := fs.Stat(sh.fsys, name)
+	if err != nil {
+		return name, nil, err
+	}
+	if info.IsDir() {
+		name = path.Join(name, "index.html")
+		if info, err = fs.Stat(sh.fsys, name); err != nil {
+			return name, nil, err
+		}
+	}
+	if !info.Mode().IsRegular() {
+		return name, nil, fs.ErrNotExist
+	}
+	return name, info, nil
+}
+
+// open returns the content of name as a seeker, which is required by [http.ServeContent].
+func (sh *StaticHandler) open(name string) (io.ReadSeeker, error) {
+	f, err := sh.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if rs, ok := f.(io.ReadSeeker); ok {
+		return rs, nil
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// etag hashes content once per name, as a file without modification time is supposed to be immutable.
+func (sh *StaticHandler) etag(name string, content io.ReadSeeker) (string, error) {
+	if etag, ok := sh.etags.Load(name); ok {
+		return etag.(string), nil
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+	sh.etags.Store(name, etag)
+	return etag, nil
+}
+
+func containsDotDot(p string) bool {
+	for _, segment := range strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if segment == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsEncoding tells whether the Accept-Encoding header value accepts encoding, with q=0 as refused.
+func acceptsEncoding(accept string, encoding string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+			continue
+		}
+		q := 1.0
+		if v, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		return q > 0
+	}
+	return false
+}
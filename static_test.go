@@ -0,0 +1,90 @@
+package wf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestStaticHandler(t *testing.T) {
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"index.html":         {Data: []byte("<html>app</html>")},
+		"app.3f2a9c1b.js":    {Data: []byte("console.log(1)")},
+		"app.3f2a9c1b.js.gz": {Data: []byte("gzipped")},
+		"docs/readme.txt":    {Data: []byte("0123456789"), ModTime: modified},
+	}
+	sh := NewStaticHandler("/ui/", fsys)
+	sh.SPA = true
+	web := NewWeb(false, sh)
+
+	do := func(method string, target string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		recorder := httptest.NewRecorder()
+		web.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	t.Run("index", func(t *testing.T) {
+		rsp := do(http.MethodGet, "/ui/")
+		if rsp.Code != http.StatusOK || rsp.Body.String() != "<html>app</html>" {
+			t.Fatalf("got %d %q", rsp.Code, rsp.Body.String())
+		}
+		etag := rsp.Header().Get("ETag")
+		if etag == "" || rsp.Header().Get("Cache-Control") != "no-cache" {
+			t.Errorf("want ETag and no-cache, got %v", rsp.Header())
+		}
+		if rsp = do(http.MethodGet, "/ui/index.html", "If-None-Match", etag); rsp.Code != http.StatusNotModified {
+			t.Errorf("want 304 on ETag, got %d", rsp.Code)
+		}
+	})
+	t.Run("spa", func(t *testing.T) {
+		if rsp := do(http.MethodGet, "/ui/users/12"); rsp.Code != http.StatusOK || rsp.Body.String() != "<html>app</html>" {
+			t.Errorf("want index.html as fallback, got %d %q", rsp.Code, rsp.Body.String())
+		}
+		if rsp := do(http.MethodGet, "/ui/docs"); rsp.Code != http.StatusOK || rsp.Body.String() != "<html>app</html>" {
+			t.Errorf("want index.html as fallback on a directory without index, got %d %q", rsp.Code, rsp.Body.String())
+		}
+		if rsp := do(http.MethodGet, "/ui/missing.js"); rsp.Code != http.StatusNotFound {
+			t.Errorf("want 404 on missing asset, got %d", rsp.Code)
+		}
+		if rsp := do(http.MethodPost, "/ui/users/12"); rsp.Code != http.StatusNotAcceptable {
+			t.Errorf("want POST unmatched, got %d", rsp.Code)
+		}
+	})
+	t.Run("immutable and precompressed", func(t *testing.T) {
+		rsp := do(http.MethodGet, "/ui/app.3f2a9c1b.js", "Accept-Encoding", "br;q=0, gzip")
+		if rsp.Body.String() != "gzipped" || rsp.Header().Get("Content-Encoding") != "gzip" {
+			t.Errorf("want gzip sibling, got %q %v", rsp.Body.String(), rsp.Header())
+		}
+		if ct := rsp.Header().Get("Content-Type"); ct != "text/javascript; charset=utf-8" {
+			t.Errorf("want content type of the original, got %q", ct)
+		}
+		if cc := rsp.Header().Get("Cache-Control"); cc != "public, max-age=31536000, immutable" {
+			t.Errorf("want immutable, got %q", cc)
+		}
+		if rsp = do(http.MethodGet, "/ui/app.3f2a9c1b.js"); rsp.Body.String() != "console.log(1)" {
+			t.Errorf("want original without Accept-Encoding, got %q", rsp.Body.String())
+		}
+	})
+	t.Run("range and modified", func(t *testing.T) {
+		rsp := do(http.MethodGet, "/ui/docs/readme.txt", "Range", "bytes=2-4")
+		if rsp.Code != http.StatusPartialContent || rsp.Body.String() != "234" {
+			t.Errorf("want 206 234, got %d %q", rsp.Code, rsp.Body.String())
+		}
+		rsp = do(http.MethodGet, "/ui/docs/readme.txt", "If-Modified-Since", modified.Format(http.TimeFormat))
+		if rsp.Code != http.StatusNotModified {
+			t.Errorf("want 304, got %d", rsp.Code)
+		}
+	})
+	t.Run("traversal", func(t *testing.T) {
+		if rsp := do(http.MethodGet, "/ui/docs/../../secret"); rsp.Code != http.StatusBadRequest {
+			t.Errorf("want 400, got %d", rsp.Code)
+		}
+	})
+}
@@ -0,0 +1,237 @@
+package wf
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpanContext identifies a span across processes, as a W3C Trace Context.
+type SpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Sampled    bool
+	TraceState string // tracestate as is, which is only passed on
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent formats sc as the traceparent header, such as 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]), flags)
+}
+
+// ParseTraceparent parses the traceparent and tracestate headers, false if traceparent is invalid.
+func ParseTraceparent(traceparent string, tracestate string) (SpanContext, bool) {
+	var sc SpanContext
+	traceparent = strings.TrimSpace(traceparent)
+	parts := strings.Split(traceparent, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 || strings.ToLower(traceparent) != traceparent {
+		return sc, false
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	sc.TraceState = tracestate
+	return sc, sc.IsValid()
+}
+
+var spanContextValue = NewContextValue[SpanContext]("span context")
+
+// AttachSpanContext makes sc the parent of spans started with ctx, and what is propagated to outgoing requests.
+// A [Tracer] attaches the context of every span it starts.
+func AttachSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return spanContextValue.Attach(ctx, sc)
+}
+
+// DetachSpanContext returns the context of the current span, false if none.
+func DetachSpanContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := spanContextValue.Detach(ctx)
+	return sc, ok && sc.IsValid()
+}
+
+// SpanKind is what a span stands for, whose values are the ones of OTLP.
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// Span is an operation being traced. It's not required to be concurrency safe.
+type Span interface {
+	SpanContext() SpanContext
+	// SetName renames the span, such as once the route of a request is found.
+	SetName(name string)
+	SetAttribute(key string, value any)
+	// RecordError marks the span failed because of err.
+	RecordError(err error)
+	End()
+}
+
+// Tracer starts spans, which could be an adapter of any tracing SDK, see [Web.SetTracer].
+type Tracer interface {
+	// Start starts a span as a child of the one of [DetachSpanContext] if any, and returns ctx with it attached.
+	Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span)
+}
+
+// SetTracer makes [Web] start a server span for every request, whose parent comes from the traceparent header,
+// with child spans for reading, Parse, Handle and Response. Nil as no tracing.
+// Better to use before the start of serving, as it's not concurrency safe.
+func (w *Web) SetTracer(t Tracer) {
+	w.tracer = t
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SpanContext() SpanContext     { return SpanContext{} }
+func (noopSpan) SetName(_ string)             {}
+func (noopSpan) SetAttribute(_ string, _ any) {}
+func (noopSpan) RecordError(_ error)          {}
+func (noopSpan) End()                         {}
+
+// startSpan starts a span by the tracer of w, or one that does nothing if none.
+func (w *Web) startSpan(ctx context.Context, name string, kind SpanKind) (context.Context, Span) {
+	if w.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return w.tracer.Start(ctx, name, kind)
+}
+
+// SpanData is a span that has ended, which is what a [SpanExporter] exports.
+type SpanData struct {
+	Name        string
+	Kind        SpanKind
+	SpanContext SpanContext
+	Parent      [8]byte // zero as a root span
+	Start       time.Time
+	End         time.Time
+	Attributes  []SpanAttribute
+	Err         string // empty as succeeded
+}
+
+type SpanAttribute struct {
+	Key   string
+	Value any
+}
+
+// SpanExporter sends ended spans somewhere, such as [NewOTLPJSONExporter].
+type SpanExporter interface {
+	ExportSpan(span *SpanData) error
+}
+
+// recordingTracer records spans and exports each once it ends.
+type recordingTracer struct {
+	exporter SpanExporter
+}
+
+// NewTracer creates a [Tracer] that exports every span through exporter once it ends, synchronously.
+// It's for testing and local debugging, use an adapter of a tracing SDK for production.
+func NewTracer(exporter SpanExporter) Tracer {
+	return &recordingTracer{exporter: exporter}
+}
+
+func (rt *recordingTracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span) {
+	s := &recordingSpan{tracer: rt, data: SpanData{Name: name, Kind: kind, Start: Now(ctx)}, ctx: ctx}
+	parent, ok := DetachSpanContext(ctx)
+	if ok {
+		s.data.SpanContext = SpanContext{TraceID: parent.TraceID, Sampled: parent.Sampled, TraceState: parent.TraceState}
+		s.data.Parent = parent.SpanID
+	} else {
+		_, _ = rand.Read(s.data.SpanContext.TraceID[:])
+		s.data.SpanContext.Sampled = true
+	}
+	_, _ = rand.Read(s.data.SpanContext.SpanID[:])
+	return AttachSpanContext(ctx, s.data.SpanContext), s
+}
+
+type recordingSpan struct {
+	tracer *recordingTracer
+	ctx    context.Context // for its clock
+	data   SpanData
+	once   sync.Once
+}
+
+func (s *recordingSpan) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+func (s *recordingSpan) SetName(name string) {
+	s.data.Name = name
+}
+
+func (s *recordingSpan) SetAttribute(key string, value any) {
+	s.data.Attributes = append(s.data.Attributes, SpanAttribute{Key: key, Value: value})
+}
+
+func (s *recordingSpan) RecordError(err error) {
+	if err != nil {
+		s.data.Err = err.Error()
+	}
+}
+
+func (s *recordingSpan) End() {
+	s.once.Do(func() {
+		s.data.End = Now(s.ctx)
+		if !s.data.SpanContext.Sampled {
+			return
+		}
+		if err := s.tracer.exporter.ExportSpan(&s.data); err != nil {
+			Logger(s.ctx).Error("unexpected failure on export span", "err", err, "name", s.data.Name)
+		}
+	})
+}
+
+type traceTransport struct {
+	base http.RoundTripper
+}
+
+// PropagateTrace makes outgoing requests through base carry the span context in their context,
+// such as of the request being served, as traceparent and tracestate. A nil base is [http.DefaultTransport].
+func PropagateTrace(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &traceTransport{base: base}
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	sc, ok := DetachSpanContext(req.Context())
+	if !ok || req.Header.Get("traceparent") != "" {
+		return t.base.RoundTrip(req)
+	}
+	// A RoundTripper must not modify the request, see its doc.
+	req = req.Clone(req.Context())
+	injectTrace(req.Header, sc)
+	return t.base.RoundTrip(req)
+}
+
+func injectTrace(header http.Header, sc SpanContext) {
+	header.Set("traceparent", sc.Traceparent())
+	if sc.TraceState != "" {
+		header.Set("tracestate", sc.TraceState)
+	}
+}
@@ -0,0 +1,113 @@
+package wf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceparent string
+		valid       bool
+		sampled     bool
+	}{
+		{"sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"not sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"future version", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, true},
+		{"extra on version 00", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"zero trace", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"upper case", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false, false},
+		{"invalid version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"empty", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, ok := ParseTraceparent(tt.traceparent, "k=v")
+			if ok != tt.valid {
+				t.Fatalf("want valid %v, got %v", tt.valid, ok)
+			}
+			if !ok {
+				return
+			}
+			if sc.Sampled != tt.sampled || sc.TraceState != "k=v" {
+				t.Errorf("unexpected %+v", sc)
+			}
+			if tt.name == "sampled" && sc.Traceparent() != tt.traceparent {
+				t.Errorf("want round trip, got %s", sc.Traceparent())
+			}
+		})
+	}
+}
+
+func TestTracing(t *testing.T) {
+	var buf bytes.Buffer
+	var outgoing string
+	upstream := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		outgoing = request.Header.Get("traceparent")
+	}))
+	defer upstream.Close()
+	client := &http.Client{Transport: PropagateTrace(nil)}
+
+	web := NewWeb(false, NewEchoHandler("/echo", 0, func(ctx context.Context, req any) (rsp any, codedError *CodedError) {
+		request, _ := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL, nil)
+		response, err := client.Do(request)
+		if err != nil {
+			return nil, NewCodedError(http.StatusBadGateway, err)
+		}
+		_ = response.Body.Close()
+		return []byte("ok"), nil
+	}))
+	web.SetTracer(NewTracer(NewOTLPJSONExporter(&buf, "test")))
+
+	req := httptest.NewRequest(http.MethodGet, "/echo", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "vendor=1")
+	web.ServeHTTP(httptest.NewRecorder(), req)
+
+	type span struct {
+		TraceID      string `json:"traceId"`
+		SpanID       string `json:"spanId"`
+		ParentSpanID string `json:"parentSpanId"`
+		TraceState   string `json:"traceState"`
+		Name         string `json:"name"`
+		Kind         int    `json:"kind"`
+	}
+	spans := map[string]span{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var request struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []span `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.Unmarshal([]byte(line), &request); err != nil {
+			t.Fatal(err)
+		}
+		s := request.ResourceSpans[0].ScopeSpans[0].Spans[0]
+		spans[s.Name] = s
+	}
+
+	server, ok := spans["GET /echo"]
+	if !ok {
+		t.Fatalf("want server span, got %v", spans)
+	}
+	if server.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || server.ParentSpanID != "00f067aa0ba902b7" ||
+		server.Kind != int(SpanKindServer) || server.TraceState != "vendor=1" {
+		t.Errorf("unexpected server span %+v", server)
+	}
+	for _, phase := range []string{"read", "parse", "handle", "response"} {
+		if s, ok := spans[phase]; !ok || s.ParentSpanID != server.SpanID || s.TraceID != server.TraceID {
+			t.Errorf("want %s as a child of server span, got %+v", phase, s)
+		}
+	}
+	if want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + spans["handle"].SpanID + "-01"; outgoing != want {
+		t.Errorf("want outgoing traceparent %s, got %s", want, outgoing)
+	}
+}
@@ -10,8 +10,12 @@ import (
 	"log/slog"
 	"net/http"
 	"reflect"
+	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -85,33 +89,55 @@ type HasResponseContentType interface {
 	ResponseContentType() string // could use [http.DetectContentType] as default, which finds JSON as text/plain.
 }
 
+// MatchFunc is a custom matcher, whose [Pattern] is opaque, see [PatternMatcher] for ones that describe themselves.
 type MatchFunc func(req *http.Request) bool
 
-func MatchAll(criteria ...MatchFunc) MatchFunc {
-	return func(req *http.Request) bool {
+func (f MatchFunc) Match(req *http.Request) bool {
+	return f(req)
+}
+
+// MatchAll accepts requests that every criterion accepts.
+func MatchAll(criteria ...CanMatch) PatternMatcher {
+	var p Pattern
+	for _, criterion := range criteria {
+		c := DescribeMatch(criterion)
+		if conflicts(p.Method, c.Method) || conflicts(p.Path, c.Path) {
+			p.Opaque = true
+		}
+		p.Method = cmp.Or(p.Method, c.Method)
+		p.Path = cmp.Or(p.Path, c.Path)
+		p.Query = append(p.Query, c.Query...)
+		p.Opaque = p.Opaque || c.Opaque
+	}
+	return PatternMatcher{func(req *http.Request) bool {
 		for _, criterion := range criteria {
-			if !criterion(req) {
+			if !criterion.Match(req) {
 				return false
 			}
 		}
 		return true
-	}
+	}, p}
+}
+
+// conflicts tells whether both criteria are required but different, where empty is any.
+func conflicts(a, b string) bool {
+	return a != "" && b != "" && a != b
 }
 
-func Exact(method string, path string) MatchFunc {
-	return func(req *http.Request) bool {
+func Exact(method string, path string) PatternMatcher {
+	return PatternMatcher{func(req *http.Request) bool {
 		return req.URL.Path == path && req.Method == method
-	}
+	}, Pattern{Method: method, Path: path}}
 }
 
-func HasQuery(key string, value string) MatchFunc {
-	return func(req *http.Request) bool {
+func HasQuery(key string, value string) PatternMatcher {
+	return PatternMatcher{func(req *http.Request) bool {
 		return req.URL.Query().Get(key) == value
-	}
+	}, Pattern{Query: []string{key + "=" + value}}}
 }
 
-func ResourceWithID(method string, pathPrefixWithTailSlash string, pathSuffixWithHeadSlashNullable string) MatchFunc {
-	return func(req *http.Request) bool {
+func ResourceWithID(method string, pathPrefixWithTailSlash string, pathSuffixWithHeadSlashNullable string) PatternMatcher {
+	return PatternMatcher{func(req *http.Request) bool {
 		if req.Method != method {
 			return false
 		}
@@ -129,10 +155,10 @@ func ResourceWithID(method string, pathPrefixWithTailSlash string, pathSuffixWit
 			return false
 		}
 		return true
-	}
+	}, Pattern{Method: method, Path: pathPrefixWithTailSlash + idPlaceholder + pathSuffixWithHeadSlashNullable}}
 }
 
-func ResourceWithIDs(method string, parts []string) (MatchFunc, ParseFunc) {
+func ResourceWithIDs(method string, parts []string) (PatternMatcher, ParseFunc) {
 	mh := func(req *http.Request) bool {
 		if req.Method != method {
 			return false
@@ -156,6 +182,10 @@ func ResourceWithIDs(method string, parts []string) (MatchFunc, ParseFunc) {
 		}
 		return true
 	}
+	segments := make([]string, len(parts))
+	for i, part := range parts {
+		segments[i] = cmp.Or(part, idPlaceholder)
+	}
 	pf := func(_ []byte, path string) (req any, err error) {
 		// The implementation of pf is highly bound with mh.
 		// We don't handle situations that won't happen. e.g.,
@@ -171,18 +201,18 @@ func ResourceWithIDs(method string, parts []string) (MatchFunc, ParseFunc) {
 		}
 		return ret, nil
 	}
-	return mh, pf
+	return PatternMatcher{mh, Pattern{Method: method, Path: "/" + strings.Join(segments, "/")}}, pf
 }
 
 type HandleFunc func(ctx context.Context, req any) (rsp any, codedError *CodedError)
 
 type closureMatcherAndParser struct {
-	matcher MatchFunc
+	matcher CanMatch
 	parser  ParseFunc
 }
 
 func (c *closureMatcherAndParser) Match(req *http.Request) bool {
-	return c.matcher(req)
+	return c.matcher.Match(req)
 }
 
 func (c *closureMatcherAndParser) Parse(data []byte, path string) (any, error) {
@@ -199,7 +229,7 @@ type ClosureHandler struct {
 }
 
 func NewClosureHandler(
-	matcher MatchFunc,
+	matcher CanMatch,
 	parser ParseFunc,
 	handler HandleFunc,
 	formatter func(output any) (data []byte, err error),
@@ -217,10 +247,19 @@ func NewClosureHandler(
 	}
 }
 
+func (ch *ClosureHandler) Describe() Route {
+	return Route{
+		Pattern:     DescribeMatch(ch.matcher),
+		Handler:     funcName(ch.handler),
+		Timeout:     ch.Timeout,
+		ContentType: ch.contentType,
+	}
+}
+
 func (ch *ClosureHandler) Response(output HandleOutputType, writer http.ResponseWriter) {
 	outputData, err := ch.Format(output)
 	if err != nil {
-		slog.Error("unexpected failure on marshal", "err", err)
+		writerLogger(writer).Error("unexpected failure on marshal", "err", err)
 		writer.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -230,7 +269,7 @@ func (ch *ClosureHandler) Response(output HandleOutputType, writer http.Response
 
 const JSONContentType = "application/json; charset=utf-8"
 
-func NewJSONHandler(matcher MatchFunc, requestType reflect.Type, handler HandleFunc) *ClosureHandler {
+func NewJSONHandler(matcher CanMatch, requestType reflect.Type, handler HandleFunc) *ClosureHandler {
 	return &ClosureHandler{
 		closureMatcherAndParser: closureMatcherAndParser{
 			matcher: matcher,
@@ -246,7 +285,7 @@ func NewJSONHandler(matcher MatchFunc, requestType reflect.Type, handler HandleF
 // Because of its long average context duration, consider
 // using global [SetTimeout] or setup handler's [TimeoutConfig] to
 // have a much longer timeout to avoid context deadline exceeded.
-func NewServerSentEventsHandler(matcher MatchFunc, parser ParseFunc, handler StreamGenerator) *ServerSentEventsHandler {
+func NewServerSentEventsHandler(matcher CanMatch, parser ParseFunc, handler StreamGenerator) *ServerSentEventsHandler {
 	return &ServerSentEventsHandler{
 		TimeoutConfig: TimeoutConfig{Timeout: 0},
 		closureMatcherAndParser: closureMatcherAndParser{
@@ -269,8 +308,19 @@ func (h *ServerSentEventsHandler) Handle(ctx context.Context, req any) (HandleOu
 	return h.handler(ctx, req)
 }
 
+func (h *ServerSentEventsHandler) Describe() Route {
+	return Route{
+		Pattern:     DescribeMatch(h.matcher),
+		Handler:     funcName(h.handler),
+		Timeout:     h.Timeout,
+		ContentType: EventStreamContentType,
+	}
+}
+
+const EventStreamContentType = "text/event-stream"
+
 func (h *ServerSentEventsHandler) Response(output HandleOutputType, writer http.ResponseWriter) {
-	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Content-Type", EventStreamContentType)
 	writer.Header().Set("Cache-Control", "no-cache")
 	writer.Header().Set("Connection", "keep-alive")
 	ch := output.(<-chan MessageEvent)
@@ -285,7 +335,7 @@ func (h *ServerSentEventsHandler) Response(output HandleOutputType, writer http.
 		}
 		_, _ = fmt.Fprintln(writer)
 		if err := rc.Flush(); err != nil {
-			slog.Error("unexpected failure on flush", "err", err)
+			writerLogger(writer).Error("unexpected failure on flush", "err", err)
 			return
 		}
 	}
@@ -335,12 +385,36 @@ func (ch *ClosureHandler) ResponseContentType() string {
 // The best performance strategy could be a code generator, which is complicated to implement.
 // Or just put the dirty transform work together as it was, which causes a lot of redundancy.
 type Web struct {
-	handlers  []Handler
-	allowCORS bool
-}
-
+	table         atomic.Pointer[routeTable] // replaced as a whole on change, see [Web.Register]
+	tableMu       sync.Mutex                 // serializes changes of table
+	listeners     []func(RouteEvent)
+	lastID        RouteID // of the route registered last, guarded by tableMu
+	allowCORS     bool
+	middlewares   []Middleware
+	authenticator Authenticator
+	logger        *slog.Logger
+	accessLog     *AccessLog
+	metrics       *Metrics
+	tracer        Tracer
+	draining      chan struct{} // closed once a Server starts draining
+	drainOnce     sync.Once
+	closing       chan struct{} // closed once streams are to be closed, after draining
+	closeOnce     sync.Once
+	finalEvent    *MessageEvent
+}
+
+// NewWeb creates a [Web] that dispatches a request to the first handler that matches.
+// Conflicts in the route table are logged rather than failed, see [Web.Validate].
 func NewWeb(allowCORS bool, handlers ...Handler) *Web {
-	return &Web{handlers: handlers, allowCORS: allowCORS}
+	w := &Web{allowCORS: allowCORS, draining: make(chan struct{}), closing: make(chan struct{})}
+	t := &routeTable{}
+	for _, h := range handlers {
+		w.lastID++
+		t = t.with(len(t.handlers), w.bind(h), w.lastID)
+	}
+	w.table.Store(t)
+	w.logConflicts()
+	return w
 }
 
 var timeout = 1000 * time.Millisecond
@@ -359,29 +433,82 @@ func withTimeout(ctx context.Context, config HaveOptionalTimeout) (context.Conte
 	return context.WithTimeoutCause(ctx, setting, cause)
 }
 
-func (w *Web) findHandler(req *http.Request) Handler {
+// findHandler returns the first handler that matches req with its route, nil if none.
+func (w *Web) findHandler(req *http.Request) (Handler, Route) {
 	// Maybe a Trie when it's more complicated and the performance difference matters.
-	for _, h := range w.handlers {
+	t := w.table.Load()
+	for i, h := range t.handlers {
 		if h.Match(req) {
-			return h
+			return h, t.routes[i]
 		}
 	}
-	return nil
+	return nil, Route{}
 }
 
 var allowedMethods = strings.Join([]string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete}, ",")
-var allowedHeaders = strings.Join([]string{"Content-Type", "Token"}, ",")
+var allowedHeaders = strings.Join([]string{"Content-Type", "Token", "Authorization", RequestIDHeader, "traceparent"}, ",")
 
 // 100 ms shall be long enough to format and send any response.
 // And not too long that would make [TestOutboundTimeout] slow.
 var writeDeadlineExtension = 100 * time.Millisecond
 
 // ServeHTTP implements that in interface.
-func (w *Web) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+func (w *Web) ServeHTTP(rawWriter http.ResponseWriter, request *http.Request) {
+	id := resolveRequestID(request)
+	logger := w.log().With("requestID", id)
+	ctx := loggerValue.Attach(AttachRequestID(request.Context(), id), logger)
+	if sc, ok := ParseTraceparent(request.Header.Get("traceparent"), request.Header.Get("tracestate")); ok {
+		ctx = AttachSpanContext(ctx, sc)
+	}
+	ctx, span := w.startSpan(ctx, request.Method, SpanKindServer)
+	request = request.WithContext(ctx)
+	writer := &responseWriter{ResponseWriter: rawWriter, logger: logger}
+	writer.Header().Set(RequestIDHeader, id)
+	start := time.Now()
+	var route Route
+	// Deferred before the recovery, so that they're run after and record the status on panic.
+	defer func() {
+		status := cmp.Or(writer.status, http.StatusOK)
+		span.SetAttribute("http.response.status_code", status)
+		if status >= http.StatusInternalServerError {
+			span.RecordError(errors.New(http.StatusText(status)))
+		}
+		span.End()
+	}()
+	if al := w.accessLog; al != nil {
+		body := al.recordBody(request)
+		defer func() {
+			al.record(logger, request, route, writer, start, body)
+		}()
+	}
+	var key *routeKey // of the request entered into metrics
+	if m := w.metrics; m != nil {
+		defer func() {
+			if key != nil {
+				m.exit(*key, cmp.Or(writer.status, http.StatusOK), writer.written, time.Since(start))
+			}
+		}()
+	}
+	defer func() {
+		p := recover()
+		if p == nil {
+			return
+		}
+		if p == http.ErrAbortHandler {
+			// The sentinel to abort a response silently, see its doc.
+			panic(p)
+		}
+		logger.Error("panic on serve", "panic", p, "method", request.Method, "url", request.URL, "stack", string(debug.Stack()))
+		if writer.status == 0 {
+			writer.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
 	if w.allowCORS {
 		writer.Header().Set("Access-Control-Allow-Origin", request.Header.Get("Origin"))
+		writer.Header().Set("Access-Control-Expose-Headers", RequestIDHeader)
 		if request.Method == http.MethodOptions {
-			slog.Warn("allow cors", "req", request)
+			logger.Warn("allow cors", "method", request.Method, "url", request.URL, "origin", request.Header.Get("Origin"))
 			writer.Header().Set("Access-Control-Allow-Methods", allowedMethods)
 			writer.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
 			writer.Header().Set("Access-Control-Max-Age", "3600") // I just love the 1hr duration.
@@ -390,17 +517,55 @@ func (w *Web) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 		}
 	}
 
-	h := w.findHandler(request)
+	h, route := w.findHandler(request)
+	if h != nil && route.Pattern.Path != "" {
+		span.SetName(request.Method + " " + route.Pattern.Path)
+	}
+	span.SetAttribute("http.request.method", request.Method)
+	span.SetAttribute("http.route", route.Pattern.String())
+	span.SetAttribute("url.path", request.URL.Path)
+	span.SetAttribute("wf.request_id", id)
+	if m := w.metrics; m != nil {
+		k := keyOf(route, h != nil)
+		m.enter(k)
+		key = &k
+	}
 	if h == nil {
 		writer.WriteHeader(http.StatusNotAcceptable)
-		slog.Warn("unmatched request", "req", request)
+		logger.Warn("unmatched request", "method", request.Method, "url", request.URL)
 		_, _ = writer.Write([]byte(fmt.Sprintf("unsupported request on %v %v", request.Method, request.URL)))
 		return
 	}
 
+	request = request.WithContext(routeValue.Attach(request.Context(), route))
+	request, ok := w.authenticate(h, writer, request)
+	if !ok {
+		return
+	}
+	if !w.authorize(h, writer, request) {
+		return
+	}
+	serve := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		w.serve(h, route, writer, request)
+	})
+	chain(serve, append(slices.Clip(w.middlewares), collectMiddlewares(h)...)).ServeHTTP(writer, request)
+}
+
+// serve reads, parses, handles and responds request with h, under the timeout of h.
+func (w *Web) serve(h Handler, route Route, writer http.ResponseWriter, request *http.Request) {
 	ctx, cancel := withTimeout(request.Context(), h)
 	defer cancel()
-	ctx = AttachToken(ctx, request.Header.Get("Token"))
+	if m := w.metrics; m != nil {
+		defer func() {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				m.timeout(keyOf(route, true))
+			}
+		}()
+	}
+	logger := Logger(ctx)
+	if token := request.Header.Get("Token"); token != "" {
+		ctx = AttachToken(ctx, token)
+	}
 	rc := http.NewResponseController(writer)
 	deadline, _ := ctx.Deadline()
 	// SetWriteDeadline with an extended deadline so that the Handle timeout could be sent,
@@ -408,39 +573,65 @@ func (w *Web) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 	if err := errors.Join(
 		rc.SetReadDeadline(deadline),
 		rc.SetWriteDeadline(deadline.Add(writeDeadlineExtension)),
-	); err != nil {
+	); err != nil && !errors.Is(err, http.ErrNotSupported) {
 		// Now that deadline must be valid, then it's OS's fault, which we cannot help.
+		// A writer without deadline support, such as [httptest.ResponseRecorder], is just not bounded.
 		panic(err)
 	}
 
+	if serveHTTP(h, writer, request.WithContext(ctx)) {
+		return
+	}
+
+	_, span := w.startSpan(ctx, "read", SpanKindInternal)
 	inputData, err := io.ReadAll(request.Body)
+	span.SetAttribute("wf.bytes", len(inputData))
+	span.RecordError(err)
+	span.End()
 	if err != nil {
 		// What if it's the client's fault? Maybe warn rather than error?
-		slog.Error("unexpected failure on read", "err", err, "req", request)
+		logger.Error("unexpected failure on read", "err", err, "method", request.Method, "url", request.URL)
 		writer.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	_, span = w.startSpan(ctx, "parse", SpanKindInternal)
 	input, err := h.Parse(inputData, request.URL.Path)
+	span.RecordError(err)
+	span.End()
 	if err != nil {
-		slog.Warn("bad input format", "err", err, "req", request)
+		logger.Warn("bad input format", "err", err, "method", request.Method, "url", request.URL)
 		writer.WriteHeader(http.StatusBadRequest)
 		// Let it go when cannot send the optional error info to a client, which could be their problem.
-		_, _ = writer.Write([]byte(fmt.Sprintf("can not parse req %v as %v", request, err)))
+		_, _ = writer.Write([]byte(fmt.Sprintf("can not parse req on %v %v as %v", request.Method, request.URL, err)))
 		return
 	}
 
-	output, e := h.Handle(ctx, input)
+	handleCtx, span := w.startSpan(ctx, "handle", SpanKindInternal)
+	output, e := h.Handle(handleCtx, input)
+	if e != nil {
+		span.SetAttribute("wf.code", e.Code)
+		span.RecordError(e)
+	}
+	span.End()
 	if e != nil {
 		if IsUserFault(e.Code) {
-			slog.Warn("resp " + e.Error())
+			logger.Warn("resp " + e.Error())
 		} else {
-			slog.Error("resp " + e.Error())
+			logger.Error("resp " + e.Error())
 		}
 		writer.WriteHeader(e.Code)
 		_, _ = writer.Write([]byte(e.Err.Error()))
 		return
 	}
+	if _, ok := handlerAs[*ServerSentEventsHandler](h); ok && w.metrics != nil {
+		defer w.metrics.stream(keyOf(route, true))()
+	}
+	if ch, ok := output.(<-chan MessageEvent); ok {
+		output = w.drainable(ctx, ch)
+	}
+	_, span = w.startSpan(ctx, "response", SpanKindInternal)
+	defer span.End()
 	h.Response(output, writer)
 }
 
@@ -448,14 +639,33 @@ func IsUserFault(httpStatusCode int) bool {
 	return httpStatusCode/100 == 4
 }
 
-const ctxTokenKey = "token"
+var tokenValue = NewContextValue[string]("token")
 
 func AttachToken(ctx context.Context, token string) context.Context {
-	return context.WithValue(ctx, ctxTokenKey, token)
+	return tokenValue.Attach(ctx, token)
 }
 
-func DetachToken(ctx context.Context) string {
-	return ctx.Value(ctxTokenKey).(string)
+// DetachToken returns the Token header of the request, false if it's absent.
+func DetachToken(ctx context.Context) (string, bool) {
+	return tokenValue.Detach(ctx)
+}
+
+// Clock tells the current time. It's [time.Now] unless replaced with [AttachClock],
+// which enables tests to control the time seen by a [HandleFunc] through [Now].
+type Clock func() time.Time
+
+var clockValue = NewContextValue[Clock]("clock")
+
+func AttachClock(ctx context.Context, clock Clock) context.Context {
+	return clockValue.Attach(ctx, clock)
+}
+
+// Now returns the current time of the [Clock] attached to ctx, or [time.Now] if none.
+func Now(ctx context.Context) time.Time {
+	if clock, ok := clockValue.Detach(ctx); ok && clock != nil {
+		return clock()
+	}
+	return time.Now()
 }
 
 type ParseFunc func(data []byte, path string) (req any, err error)
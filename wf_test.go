@@ -106,7 +106,7 @@ func TestResourceWithIDs(t *testing.T) {
 				t.Fatalf("parse url failed: %v", err)
 			}
 
-			ok := mf(&http.Request{Method: tt.method, URL: u})
+			ok := mf.Match(&http.Request{Method: tt.method, URL: u})
 			if ok != tt.match {
 				t.Errorf("match got %t want %t", ok, tt.match)
 			}
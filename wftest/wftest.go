@@ -0,0 +1,297 @@
+// Package wftest is an in-memory harness to test [wf.Handler] and [wf.Web] without opening sockets.
+//
+// A typical test looks like
+//
+//	h := wftest.NewHandler(t, handler)
+//	var rsp Response
+//	h.Post("/v1/whole").JSON(Request{ID: 1}).Do().AssertStatus(http.StatusOK).DecodeJSON(&rsp)
+package wftest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyisen/wf"
+)
+
+// Harness sends requests through an [http.Handler], which is [wf.Web] in most cases.
+// Its settings are the defaults of every [Request] it creates.
+type Harness struct {
+	t       testing.TB
+	handler http.Handler
+	header  http.Header
+	clock   wf.Clock
+	timeout time.Duration
+}
+
+func New(t testing.TB, handler http.Handler) *Harness {
+	return &Harness{t: t, handler: handler, header: http.Header{}}
+}
+
+// NewHandler tests handlers through a [wf.Web] without CORS.
+func NewHandler(t testing.TB, handlers ...wf.Handler) *Harness {
+	return New(t, wf.NewWeb(false, handlers...))
+}
+
+// WithClock makes [wf.Now] in handlers return the time of clock.
+func (h *Harness) WithClock(clock wf.Clock) *Harness {
+	h.clock = clock
+	return h
+}
+
+// WithTimeout bounds every request with a deadline, which shortens the one set by [wf.Web]
+// if it's shorter than the handler or global timeout.
+func (h *Harness) WithTimeout(timeout time.Duration) *Harness {
+	h.timeout = timeout
+	return h
+}
+
+// WithToken sends token in the header that [wf.Web] attaches to ctx for [wf.DetachToken].
+func (h *Harness) WithToken(token string) *Harness {
+	h.header.Set("Token", token)
+	return h
+}
+
+func (h *Harness) WithHeader(key string, value string) *Harness {
+	h.header.Set(key, value)
+	return h
+}
+
+func (h *Harness) Get(target string) *Request {
+	return h.Request(http.MethodGet, target)
+}
+
+func (h *Harness) Post(target string) *Request {
+	return h.Request(http.MethodPost, target)
+}
+
+func (h *Harness) Put(target string) *Request {
+	return h.Request(http.MethodPut, target)
+}
+
+func (h *Harness) Delete(target string) *Request {
+	return h.Request(http.MethodDelete, target)
+}
+
+func (h *Harness) Request(method string, target string) *Request {
+	return &Request{
+		h:       h,
+		method:  method,
+		target:  target,
+		header:  h.header.Clone(),
+		clock:   h.clock,
+		timeout: h.timeout,
+	}
+}
+
+// Request is built fluently and sent by [Request.Do].
+type Request struct {
+	h       *Harness
+	method  string
+	target  string
+	header  http.Header
+	body    []byte
+	clock   wf.Clock
+	timeout time.Duration
+}
+
+func (r *Request) Header(key string, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+func (r *Request) Token(token string) *Request {
+	return r.Header("Token", token)
+}
+
+func (r *Request) Clock(clock wf.Clock) *Request {
+	r.clock = clock
+	return r
+}
+
+func (r *Request) Timeout(timeout time.Duration) *Request {
+	r.timeout = timeout
+	return r
+}
+
+func (r *Request) Body(data []byte) *Request {
+	r.body = data
+	return r
+}
+
+// JSON marshals v as the body, fails the test once it cannot.
+func (r *Request) JSON(v any) *Request {
+	r.h.t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		r.h.t.Fatalf("marshal request body: %v", err)
+	}
+	r.header.Set("Content-Type", wf.JSONContentType)
+	return r.Body(data)
+}
+
+// Do serves the request synchronously, which means a stream ends before it returns.
+func (r *Request) Do() *Response {
+	req := httptest.NewRequest(r.method, r.target, bytes.NewReader(r.body))
+	req.Header = r.header
+	ctx := req.Context()
+	if r.clock != nil {
+		ctx = wf.AttachClock(ctx, r.clock)
+	}
+	if r.timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	recorder := httptest.NewRecorder()
+	r.h.handler.ServeHTTP(recorder, req.WithContext(ctx))
+	return &Response{t: r.h.t, Recorder: recorder}
+}
+
+// Response wraps what has been recorded, with assertions that report through testing.TB.
+// The assertions return the Response itself, so that they could be chained.
+type Response struct {
+	t        testing.TB
+	Recorder *httptest.ResponseRecorder
+}
+
+func (r *Response) Status() int {
+	return r.Recorder.Code
+}
+
+func (r *Response) Header() http.Header {
+	return r.Recorder.Header()
+}
+
+func (r *Response) Body() []byte {
+	return r.Recorder.Body.Bytes()
+}
+
+func (r *Response) AssertStatus(code int) *Response {
+	r.t.Helper()
+	if r.Status() != code {
+		r.t.Errorf("want status %d, got %d with body %q", code, r.Status(), r.Body())
+	}
+	return r
+}
+
+func (r *Response) AssertHeader(key string, value string) *Response {
+	r.t.Helper()
+	if got := r.Header().Get(key); got != value {
+		r.t.Errorf("want header %s %q, got %q", key, value, got)
+	}
+	return r
+}
+
+func (r *Response) AssertBody(body string) *Response {
+	r.t.Helper()
+	if got := string(r.Body()); got != body {
+		r.t.Errorf("want body %q, got %q", body, got)
+	}
+	return r
+}
+
+func (r *Response) AssertBodyContains(keyword string) *Response {
+	r.t.Helper()
+	if got := string(r.Body()); !strings.Contains(got, keyword) {
+		r.t.Errorf("want body with keyword %q, got %q", keyword, got)
+	}
+	return r
+}
+
+// DecodeJSON unmarshals the body into v, fails the test once it cannot.
+func (r *Response) DecodeJSON(v any) *Response {
+	r.t.Helper()
+	if err := json.Unmarshal(r.Body(), v); err != nil {
+		r.t.Fatalf("unmarshal body %q: %v", r.Body(), err)
+	}
+	return r
+}
+
+// AssertJSON decodes the body into a new value of the type of want, and compares them deeply.
+func (r *Response) AssertJSON(want any) *Response {
+	r.t.Helper()
+	got := reflect.New(reflect.TypeOf(want))
+	r.DecodeJSON(got.Interface())
+	if !reflect.DeepEqual(got.Elem().Interface(), want) {
+		r.t.Errorf("want JSON %+v, got %+v", want, got.Elem().Interface())
+	}
+	return r
+}
+
+// Events parses the body as a Server-Sent-Events stream.
+func (r *Response) Events() []wf.MessageEvent {
+	var ret []wf.MessageEvent
+	var current wf.MessageEvent
+	scanner := bufio.NewScanner(bytes.NewReader(r.Body()))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			ret = append(ret, current)
+			current = wf.MessageEvent{}
+		case strings.HasPrefix(line, "event: "):
+			current.TypeOptional = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			current.Lines = append(current.Lines, strings.TrimPrefix(line, "data: "))
+		}
+	}
+	return ret
+}
+
+func (r *Response) AssertEvents(want ...wf.MessageEvent) *Response {
+	r.t.Helper()
+	got := r.Events()
+	if !slices.EqualFunc(got, want, func(a wf.MessageEvent, b wf.MessageEvent) bool {
+		return a.TypeOptional == b.TypeOptional && slices.Equal(a.Lines, b.Lines)
+	}) {
+		r.t.Errorf("want events %+v, got %+v", want, got)
+	}
+	return r
+}
+
+// JSON decodes the body of r as T, fails the test once it cannot.
+func JSON[T any](r *Response) T {
+	r.t.Helper()
+	var ret T
+	r.DecodeJSON(&ret)
+	return ret
+}
+
+// Clock is a manual [wf.Clock] for tests, which only moves on [Clock.Advance] or [Clock.Set].
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
@@ -0,0 +1,97 @@
+package wftest
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hyisen/wf"
+)
+
+type request struct {
+	Name string `json:"name"`
+}
+
+type response struct {
+	Greeting string    `json:"greeting"`
+	Token    string    `json:"token"`
+	At       time.Time `json:"at"`
+}
+
+func newGreetHandler() wf.Handler {
+	return wf.NewJSONHandler(
+		wf.Exact(http.MethodPost, "/greet"),
+		reflect.TypeOf(request{}),
+		func(ctx context.Context, req any) (rsp any, codedError *wf.CodedError) {
+			r := req.(*request)
+			if r.Name == "" {
+				return nil, wf.NewCodedErrorf(http.StatusBadRequest, "empty name")
+			}
+			token, _ := wf.DetachToken(ctx)
+			return response{Greeting: "hi " + r.Name, Token: token, At: wf.Now(ctx)}, nil
+		},
+	)
+}
+
+func TestJSON(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewClock(at)
+	h := NewHandler(t, newGreetHandler()).WithClock(clock.Now).WithToken("secret")
+
+	h.Post("/greet").JSON(request{Name: "Bob"}).Do().
+		AssertStatus(http.StatusOK).
+		AssertHeader("Content-Type", wf.JSONContentType).
+		AssertJSON(response{Greeting: "hi Bob", Token: "secret", At: at})
+
+	clock.Advance(time.Hour)
+	got := JSON[response](h.Post("/greet").JSON(request{Name: "Bob"}).Token("other").Do())
+	if !got.At.Equal(at.Add(time.Hour)) || got.Token != "other" {
+		t.Errorf("want advanced clock and overridden token, got %+v", got)
+	}
+
+	h.Post("/greet").JSON(request{}).Do().AssertStatus(http.StatusBadRequest).AssertBody("empty name")
+	h.Get("/greet").Do().AssertStatus(http.StatusNotAcceptable)
+}
+
+func TestTimeout(t *testing.T) {
+	h := NewHandler(t, wf.NewClosureHandler(
+		wf.Exact(http.MethodGet, "/slow"),
+		wf.ParseEmpty,
+		func(ctx context.Context, req any) (rsp any, codedError *wf.CodedError) {
+			<-ctx.Done()
+			return nil, wf.NewCodedError(http.StatusGatewayTimeout, context.Cause(ctx))
+		},
+		wf.FormatEmpty,
+		"text/plain",
+	))
+
+	h.Get("/slow").Timeout(time.Millisecond).Do().AssertStatus(http.StatusGatewayTimeout)
+}
+
+func TestEvents(t *testing.T) {
+	want := []wf.MessageEvent{
+		{TypeOptional: "", Lines: []string{"one"}},
+		{TypeOptional: "done", Lines: []string{"two", "three"}},
+	}
+	h := NewHandler(t, wf.NewServerSentEventsHandler(
+		wf.Exact(http.MethodGet, "/events"),
+		wf.ParseEmpty,
+		func(ctx context.Context, req any) (<-chan wf.MessageEvent, *wf.CodedError) {
+			ch := make(chan wf.MessageEvent)
+			go func() {
+				defer close(ch)
+				for _, me := range want {
+					ch <- me
+				}
+			}()
+			return ch, nil
+		},
+	))
+
+	h.Get("/events").Do().
+		AssertStatus(http.StatusOK).
+		AssertHeader("Content-Type", "text/event-stream").
+		AssertEvents(want...)
+}
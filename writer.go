@@ -0,0 +1,150 @@
+package wf
+
+import (
+	"bufio"
+	"bytes"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// responseWriter records what has been written through it, which [Web] wraps every response with,
+// so that it could tell whether it's too late to respond an error, such as on a panic.
+type responseWriter struct {
+	http.ResponseWriter
+	status  int // zero as nothing written
+	written int64
+	logger  *slog.Logger // with the request ID, for a Response that has no ctx
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if rw.status == 0 && code >= http.StatusOK {
+		rw.status = code
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(p)
+	rw.written += int64(n)
+	return n, err
+}
+
+// Unwrap enables [http.ResponseController] to reach what's wrapped.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Flush is for mounted handlers that assert [http.Flusher] rather than use [http.ResponseController].
+func (rw *responseWriter) Flush() {
+	_ = http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+// Hijack is for mounted handlers that assert [http.Hijacker], such as a WebSocket upgrader.
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
+
+// recordingWriter finds the responseWriter that [Web] wraps writer with, through any wrapping middleware.
+func recordingWriter(writer http.ResponseWriter) (*responseWriter, bool) {
+	for {
+		switch w := writer.(type) {
+		case *responseWriter:
+			return w, true
+		case interface{ Unwrap() http.ResponseWriter }:
+			writer = w.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// capturingWriter keeps a copy of the response written through it, for it to be replayed.
+type capturingWriter struct {
+	http.ResponseWriter
+	before http.Header // as of capture
+	status int
+	header http.Header // as of WriteHeader
+	body   bytes.Buffer
+}
+
+// capture wraps writer, whose headers set so far are taken as the ones of the request rather than the response.
+func capture(writer http.ResponseWriter) *capturingWriter {
+	return &capturingWriter{ResponseWriter: writer, before: writer.Header().Clone()}
+}
+
+func (cw *capturingWriter) WriteHeader(code int) {
+	if cw.status == 0 && code >= http.StatusOK {
+		cw.status = code
+		cw.header = cw.Header().Clone()
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *capturingWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	cw.body.Write(p)
+	return cw.ResponseWriter.Write(p)
+}
+
+func (cw *capturingWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// captured returns the status written, as 200 if nothing written, and the headers set or changed since capture.
+func (cw *capturingWriter) captured() (int, http.Header) {
+	status, header := cw.status, cw.header
+	if status == 0 {
+		status, header = http.StatusOK, cw.Header().Clone()
+	}
+	for name, values := range header {
+		if slices.Equal(values, cw.before[name]) {
+			delete(header, name)
+		}
+	}
+	return status, header
+}
+
+// replayable drops headers that only apply to the request they're for, such as X-Request-ID, CORS and RateLimit,
+// from header captured to be replayed to other requests.
+func replayable(header http.Header) http.Header {
+	for name := range header {
+		switch {
+		case name == RequestIDHeader, name == "Retry-After", name == "X-Cache", name == "Age", name == "Idempotent-Replayed",
+			strings.HasPrefix(name, "Access-Control-"), strings.HasPrefix(name, "Ratelimit-"):
+			delete(header, name)
+		}
+	}
+	return header
+}
+
+// replay writes a captured response, with headers already set to writer kept unless overwritten.
+func replay(writer http.ResponseWriter, status int, header http.Header, body []byte) {
+	for name, values := range header {
+		writer.Header()[name] = slices.Clone(values)
+	}
+	writer.WriteHeader(status)
+	_, _ = writer.Write(body)
+}
+
+// discardWriter is for serving a request in background, whose response is only captured.
+type discardWriter struct {
+	header http.Header
+}
+
+func (dw *discardWriter) Header() http.Header {
+	return dw.header
+}
+
+func (dw *discardWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (dw *discardWriter) WriteHeader(int) {}